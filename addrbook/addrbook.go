@@ -0,0 +1,339 @@
+// Package addrbook keeps the addresses of known peers.
+package addrbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+)
+
+const (
+	// MaxEntries is the maximum number of addresses in the book.
+	MaxEntries = 10000
+	// StaleAge is how long an address that we have not heard of since may be evicted from a full book.
+	StaleAge = 7 * 24 * time.Hour
+)
+
+// Entry is what we know about an address.
+type Entry struct {
+	// Addr is the host:port address.
+	Addr string
+	// Capabilities are the capabilities advertised by the peer.
+	Capabilities message.Capabilities
+	// LastSeen is when we last heard of the address or were connected to it.
+	LastSeen time.Time
+	// LastAttempt is when we last tried to connect.
+	LastAttempt time.Time
+	// LastSuccess is when we last completed a handshake.
+	LastSuccess time.Time
+	// Successes is the number of completed handshakes.
+	Successes int
+	// Failures is the number of failed connection attempts.
+	Failures int
+}
+
+// Good returns true if the last attempt to connect to the address succeeded.
+func (e *Entry) Good() bool {
+	return e.Successes > 0 && !e.LastSuccess.Before(e.LastAttempt)
+}
+
+// Book keeps the addresses of known peers.
+// It is safe for concurrent use.
+type Book struct {
+	// storage persists the book. The book is kept in memory only if it is nil.
+	storage Storage
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	// dirty is true if the book changed since it was saved.
+	dirty bool
+}
+
+// New returns an empty book saved to the file at the path.
+// The book is kept in memory only if the path is empty.
+func New(path string) *Book {
+	b := &Book{entries: make(map[string]*Entry)}
+	if path != "" {
+		b.storage = File(path)
+	}
+	return b
+}
+
+// Load returns the book saved to the file at the path.
+// An empty book is returned if the file does not exist.
+func Load(path string) (*Book, error) {
+	return Open(File(path))
+}
+
+// Open returns the book saved in the storage.
+func Open(s Storage) (*Book, error) {
+	entries, err := s.LoadAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("could not load address book: %v", err)
+	}
+	b := &Book{storage: s, entries: make(map[string]*Entry, len(entries))}
+	for i := range entries {
+		b.entries[entries[i].Addr] = &entries[i]
+	}
+	return b, nil
+}
+
+// Save writes the book to its storage if it changed.
+func (b *Book) Save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.storage == nil || !b.dirty {
+		return nil
+	}
+	entries := make([]Entry, 0, len(b.entries))
+	for _, e := range b.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Addr < entries[j].Addr })
+	if err := b.storage.SaveAddrs(entries); err != nil {
+		return fmt.Errorf("could not save address book: %v", err)
+	}
+	b.dirty = false
+	return nil
+}
+
+// saveJSON writes the value encoded as JSON to the file at the path.
+// It writes to a temporary file first so that a crash does not leave a truncated file.
+func saveJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadJSON decodes the JSON file at the path into the value.
+// It returns false if the file does not exist.
+func loadJSON(path string, v interface{}) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Len returns the number of addresses in the book.
+func (b *Book) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.entries)
+}
+
+// Entry returns a copy of the entry for the address.
+func (b *Book) Entry(addr string) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[addr]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// AddAddrs adds host:port addresses, such as seeds.
+func (b *Book) AddAddrs(addrs ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, a := range addrs {
+		b.entry(a)
+	}
+}
+
+// Add adds the addresses received from a peer. Addresses that cannot be connected to are skipped.
+func (b *Book) Add(addrs ...message.SockAddr) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	for _, a := range addrs {
+		if !routable(a) {
+			continue
+		}
+		if e := b.entry(a.String()); e != nil {
+			e.LastSeen = now
+			b.dirty = true
+		}
+	}
+}
+
+// Attempt records an attempt to connect to the address.
+func (b *Book) Attempt(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e := b.entry(addr); e != nil {
+		e.LastAttempt = time.Now()
+		b.dirty = true
+	}
+}
+
+// Success records a completed handshake with the address.
+func (b *Book) Success(addr string, capabilities message.Capabilities) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e := b.entry(addr); e != nil {
+		now := time.Now()
+		e.Capabilities = capabilities
+		e.LastSeen = now
+		e.LastSuccess = now
+		e.Successes++
+		b.dirty = true
+	}
+}
+
+// Failure records a failed attempt to connect to the address.
+func (b *Book) Failure(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e := b.entry(addr); e != nil {
+		e.Failures++
+		b.dirty = true
+	}
+}
+
+// Remove removes the address.
+func (b *Book) Remove(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.entries[addr]; ok {
+		delete(b.entries, addr)
+		b.dirty = true
+	}
+}
+
+// Candidates returns the addresses to connect to, best first:
+// the good ones, then the ones never tried, then the ones that failed.
+func (b *Book) Candidates() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var good, untried, failed []string
+	for a, e := range b.entries {
+		switch {
+		case e.Good():
+			good = append(good, a)
+		case e.LastAttempt.IsZero():
+			untried = append(untried, a)
+		default:
+			failed = append(failed, a)
+		}
+	}
+	for _, s := range [][]string{good, untried, failed} {
+		rand.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+	}
+	return append(append(good, untried...), failed...)
+}
+
+// Sample returns up to n random good addresses with the capabilities, to be sent to peers.
+// Only addresses with an IP are returned.
+func (b *Book) Sample(n int, capabilities message.Capabilities) []message.SockAddr {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var addrs []message.SockAddr
+	for a, e := range b.entries {
+		if !e.Good() || !e.Capabilities.Has(capabilities) {
+			continue
+		}
+		if v, ok := parseSockAddr(a); ok {
+			addrs = append(addrs, v)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+	if len(addrs) > n {
+		addrs = addrs[:n]
+	}
+	return addrs
+}
+
+// entry returns the entry for the address, adding it if there is room.
+// A failed or stale entry is evicted to make room if the book is full. It returns nil if there is none.
+func (b *Book) entry(addr string) *Entry {
+	e, ok := b.entries[addr]
+	if ok {
+		return e
+	}
+	if len(b.entries) >= MaxEntries && !b.evict() {
+		return nil
+	}
+	e = &Entry{Addr: addr}
+	b.entries[addr] = e
+	b.dirty = true
+	return e
+}
+
+// evict removes the entry with the most failures, or the one heard of least recently if none failed.
+// Good entries and entries not heard of for less than StaleAge are kept unless they failed.
+// It returns false if no entry could be evicted.
+func (b *Book) evict() bool {
+	stale := time.Now().Add(-StaleAge)
+	var worst *Entry
+	for _, e := range b.entries {
+		if e.Good() || (e.Failures == 0 && (e.LastSeen.IsZero() || e.LastSeen.After(stale))) {
+			continue
+		}
+		if worst == nil || e.Failures > worst.Failures || (e.Failures == worst.Failures && e.LastSeen.Before(worst.LastSeen)) {
+			worst = e
+		}
+	}
+	if worst == nil {
+		return false
+	}
+	delete(b.entries, worst.Addr)
+	return true
+}
+
+// sharedAddrSpace is the address space shared by carrier-grade NATs (RFC 6598).
+var sharedAddrSpace = net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// routable returns true if the address may be connected to over the internet.
+// Private addresses (RFC 1918 and IP v6 unique local addresses) and carrier-grade NAT addresses are not.
+func routable(a message.SockAddr) bool {
+	ip := a.Addr.IP
+	if a.Port == 0 || ip == nil {
+		return false
+	}
+	return !ip.IsUnspecified() && !ip.IsLoopback() && !ip.IsMulticast() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsPrivate() && !sharedAddrSpace.Contains(ip)
+}
+
+// parseSockAddr parses an ip:port address.
+func parseSockAddr(addr string) (message.SockAddr, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return message.SockAddr{}, false
+	}
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return message.SockAddr{}, false
+	}
+	return message.SockAddr{Addr: net.IPAddr{IP: ip}, Port: uint16(p)}, true
+}
@@ -0,0 +1,131 @@
+package addrbook
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+)
+
+func sockAddr(t *testing.T, s string) message.SockAddr {
+	a, err := net.ResolveTCPAddr("tcp", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return message.NewSockAddr(a)
+}
+
+func TestCandidates(t *testing.T) {
+	b := New("")
+	b.AddAddrs("seed.example.org:13414")
+	b.Add(sockAddr(t, "203.0.113.1:13414"), sockAddr(t, "[2001:db8::1]:13414"))
+	// 203.0.113.1 is good, the seed failed and the IP v6 address was never tried.
+	b.Attempt("203.0.113.1:13414")
+	b.Success("203.0.113.1:13414", message.FullNodeCapabilities)
+	b.Attempt("seed.example.org:13414")
+	b.Failure("seed.example.org:13414")
+	want := []string{"203.0.113.1:13414", "[2001:db8::1]:13414", "seed.example.org:13414"}
+	if got := b.Candidates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong candidates: expecting %v, got %v", want, got)
+	}
+	e, ok := b.Entry("seed.example.org:13414")
+	if !ok || e.Failures != 1 || e.Good() {
+		t.Errorf("wrong entry for failed seed: %+v", e)
+	}
+}
+
+func TestAddUnroutable(t *testing.T) {
+	b := New("")
+	for _, a := range []string{"0.0.0.0:13414", "[::]:13414", "127.0.0.1:13414", "[::1]:13414", "224.0.0.1:13414", "203.0.113.1:0",
+		"10.0.0.1:13414", "172.16.0.1:13414", "192.168.0.1:13414", "100.64.0.1:13414", "100.127.255.254:13414", "[fc00::1]:13414", "[fd12::1]:13414"} {
+		b.Add(sockAddr(t, a))
+	}
+	if b.Len() != 0 {
+		t.Errorf("unroutable addresses added: %v", b.Candidates())
+	}
+	// Next to the shared address space of carrier-grade NATs.
+	b.Add(sockAddr(t, "100.63.255.255:13414"), sockAddr(t, "100.128.0.1:13414"))
+	if b.Len() != 2 {
+		t.Errorf("routable addresses not added: %v", b.Candidates())
+	}
+}
+
+func TestEvict(t *testing.T) {
+	b := New("")
+	for i := 1; i <= MaxEntries; i++ {
+		b.Add(sockAddr(t, fmt.Sprintf("[2001:db8::%x]:13414", i)))
+	}
+	// Every entry was just heard of, so there is no room.
+	b.dirty = false
+	b.Add(sockAddr(t, "[2001:db8:1::1]:13414"))
+	if _, ok := b.Entry("[2001:db8:1::1]:13414"); ok || b.Len() != MaxEntries {
+		t.Fatalf("address added to a full book of fresh entries, %v entries", b.Len())
+	}
+	if b.dirty {
+		t.Error("book changed although no address was added")
+	}
+	// A failed entry makes room.
+	b.Failure("[2001:db8::1]:13414")
+	b.Add(sockAddr(t, "[2001:db8:1::1]:13414"))
+	if _, ok := b.Entry("[2001:db8::1]:13414"); ok {
+		t.Error("failed entry not evicted")
+	}
+	// So does a stale one.
+	b.entries["[2001:db8::2]:13414"].LastSeen = time.Now().Add(-2 * StaleAge)
+	b.Add(sockAddr(t, "[2001:db8:1::2]:13414"))
+	if _, ok := b.Entry("[2001:db8::2]:13414"); ok {
+		t.Error("stale entry not evicted")
+	}
+	if _, ok := b.Entry("[2001:db8:1::2]:13414"); !ok || b.Len() != MaxEntries {
+		t.Errorf("address not added in place of evicted entry, %v entries", b.Len())
+	}
+}
+
+func TestSample(t *testing.T) {
+	b := New("")
+	for _, a := range []string{"203.0.113.1:1", "203.0.113.2:2", "203.0.113.3:3"} {
+		b.Attempt(a)
+	}
+	b.Success("203.0.113.1:1", message.FullNodeCapabilities)
+	b.Success("203.0.113.2:2", message.PeerListCapabilities)
+	b.AddAddrs("host.example.org:4")
+	b.Attempt("host.example.org:4")
+	b.Success("host.example.org:4", message.FullNodeCapabilities)
+	if got := b.Sample(10, message.UnknownCapabilities); len(got) != 2 {
+		t.Errorf("wrong number of good addresses: expecting 2, got %v", got)
+	}
+	got := b.Sample(10, message.HeaderHistCapabilities)
+	if len(got) != 1 || got[0].String() != "203.0.113.1:1" {
+		t.Errorf("wrong addresses with header history: %v", got)
+	}
+	if got := b.Sample(1, message.UnknownCapabilities); len(got) != 1 {
+		t.Errorf("wrong number of sampled addresses: expecting 1, got %v", len(got))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	b, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Add(sockAddr(t, "203.0.113.1:13414"))
+	b.Attempt("203.0.113.1:13414")
+	b.Success("203.0.113.1:13414", message.PeerListCapabilities)
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := b.Entry("203.0.113.1:13414")
+	got, ok := loaded.Entry("203.0.113.1:13414")
+	if !ok || got.Successes != 1 || got.Capabilities != message.PeerListCapabilities || !got.LastSuccess.Equal(want.LastSuccess) {
+		t.Errorf("wrong loaded entry: expecting %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,114 @@
+package addrbook
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Ban is a banned IP address.
+type Ban struct {
+	// IP is the banned IP address.
+	IP string
+	// Reason is why the address was banned.
+	Reason string
+	// Until is when the ban expires.
+	Until time.Time
+}
+
+// BanList keeps the banned IP addresses.
+// It is safe for concurrent use.
+type BanList struct {
+	// storage persists the list. The list is kept in memory only if it is nil.
+	storage BanStorage
+
+	mu   sync.Mutex
+	bans map[string]Ban
+}
+
+// NewBanList returns an empty ban list saved to the file at the path.
+// The list is kept in memory only if the path is empty.
+func NewBanList(path string) *BanList {
+	l := &BanList{bans: make(map[string]Ban)}
+	if path != "" {
+		l.storage = File(path)
+	}
+	return l
+}
+
+// LoadBanList returns the ban list saved to the file at the path.
+// An empty list is returned if the file does not exist.
+func LoadBanList(path string) (*BanList, error) {
+	return OpenBanList(File(path))
+}
+
+// OpenBanList returns the ban list saved in the storage.
+func OpenBanList(s BanStorage) (*BanList, error) {
+	bans, err := s.LoadBans()
+	if err != nil {
+		return nil, fmt.Errorf("could not load ban list: %v", err)
+	}
+	l := &BanList{storage: s, bans: make(map[string]Ban, len(bans))}
+	for _, b := range bans {
+		l.bans[b.IP] = b
+	}
+	return l, nil
+}
+
+// Save writes the list to its storage.
+func (l *BanList) Save() error {
+	if l.storage == nil {
+		return nil
+	}
+	if err := l.storage.SaveBans(l.List()); err != nil {
+		return fmt.Errorf("could not save ban list: %v", err)
+	}
+	return nil
+}
+
+// Ban bans the IP address for the duration.
+func (l *BanList) Ban(ip net.IP, d time.Duration, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bans[ip.String()] = Ban{IP: ip.String(), Reason: reason, Until: time.Now().Add(d)}
+}
+
+// Lift lifts the ban on the IP address. It returns false if the address was not banned.
+func (l *BanList) Lift(ip net.IP) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.bans[ip.String()]
+	delete(l.bans, ip.String())
+	return ok
+}
+
+// IsBanned returns true if the IP address is banned.
+func (l *BanList) IsBanned(ip net.IP) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.bans[ip.String()]
+	if ok && !time.Now().Before(b.Until) {
+		delete(l.bans, b.IP)
+		return false
+	}
+	return ok
+}
+
+// List returns the bans that have not expired, sorted by IP address.
+func (l *BanList) List() []Ban {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	bans := make([]Ban, 0, len(l.bans))
+	for ip, b := range l.bans {
+		if !now.Before(b.Until) {
+			delete(l.bans, ip)
+			continue
+		}
+		bans = append(bans, b)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return bans
+}
@@ -0,0 +1,39 @@
+package addrbook
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	l, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := net.ParseIP("10.0.0.1"), net.ParseIP("2001:db8::1")
+	l.Ban(a, time.Hour, "bad magic")
+	l.Ban(b, -time.Second, "expired")
+	if !l.IsBanned(a) || l.IsBanned(b) {
+		t.Error("wrong bans")
+	}
+	if err := l.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bans := loaded.List()
+	if len(bans) != 1 || bans[0].IP != "10.0.0.1" || bans[0].Reason != "bad magic" {
+		t.Errorf("wrong loaded bans: %v", bans)
+	}
+	if !loaded.Lift(a) || loaded.IsBanned(a) {
+		t.Error("ban not lifted")
+	}
+	if loaded.Lift(a) {
+		t.Error("lifted ban twice")
+	}
+}
@@ -0,0 +1,44 @@
+package addrbook
+
+// Storage persists the entries of a book.
+type Storage interface {
+	// LoadAddrs returns the saved entries.
+	LoadAddrs() ([]Entry, error)
+	// SaveAddrs replaces the saved entries.
+	SaveAddrs(entries []Entry) error
+}
+
+// BanStorage persists the bans of a ban list.
+type BanStorage interface {
+	// LoadBans returns the saved bans.
+	LoadBans() ([]Ban, error)
+	// SaveBans replaces the saved bans.
+	SaveBans(bans []Ban) error
+}
+
+// File is the path of a JSON file holding a book or a ban list.
+type File string
+
+// LoadAddrs returns the entries in the file, or none if it does not exist.
+func (f File) LoadAddrs() ([]Entry, error) {
+	var entries []Entry
+	_, err := loadJSON(string(f), &entries)
+	return entries, err
+}
+
+// SaveAddrs writes the entries to the file.
+func (f File) SaveAddrs(entries []Entry) error {
+	return saveJSON(string(f), entries)
+}
+
+// LoadBans returns the bans in the file, or none if it does not exist.
+func (f File) LoadBans() ([]Ban, error) {
+	var bans []Ban
+	_, err := loadJSON(string(f), &bans)
+	return bans, err
+}
+
+// SaveBans writes the bans to the file.
+func (f File) SaveBans(bans []Ban) error {
+	return saveJSON(string(f), bans)
+}
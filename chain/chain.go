@@ -0,0 +1,372 @@
+// Package chain keeps the chain of block headers.
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/store"
+	"github.com/zkirill/gringo/validation"
+)
+
+var (
+	// ErrOrphan is returned when adding a header whose parent is unknown.
+	ErrOrphan = errors.New("parent of header unknown")
+	// ErrNotFound is returned when there is no such header.
+	ErrNotFound = errors.New("header not found")
+)
+
+// BlockID identifies a block.
+type BlockID struct {
+	// Hash is the hash of the block.
+	Hash message.Hash
+	// Height is the height of the block.
+	Height uint64
+}
+
+// Reorg is the switch of the best chain to another branch.
+type Reorg struct {
+	// Old is the head of the best chain before the switch.
+	Old BlockID
+	// New is the head of the best chain after the switch.
+	New BlockID
+	// Ancestor is the last block that both branches share.
+	Ancestor BlockID
+}
+
+// entry is a header with its hash.
+type entry struct {
+	header message.BlockHeader
+	hash   message.Hash
+}
+
+// Chain holds the block headers from the genesis on every known branch.
+// The best chain is the branch with the most total difficulty. On a tie the branch seen first stays best.
+// It is safe for concurrent use.
+type Chain struct {
+	// Rules are the rules that added headers must follow. They must be set before adding headers.
+	Rules validation.Rules
+
+	mu sync.RWMutex
+	// headers are the headers of every branch by hash.
+	headers map[message.Hash]*entry
+	// best are the headers of the best chain by height.
+	best []*entry
+	// tips are the hashes of the headers without children.
+	tips map[message.Hash]struct{}
+	// onReorg are called after every reorg.
+	onReorg []func(Reorg)
+	// store persists the headers and the best chain. It may be nil.
+	store store.Store
+}
+
+// New returns a chain with only the genesis header.
+// The hash of the genesis is given because only the regtest genesis header is defined fully enough to be hashed.
+func New(genesis message.BlockHeader, hash message.Hash) *Chain {
+	e := &entry{header: genesis, hash: hash}
+	return &Chain{
+		headers: map[message.Hash]*entry{hash: e},
+		best:    []*entry{e},
+		tips:    map[message.Hash]struct{}{hash: {}},
+	}
+}
+
+// Load returns a chain with the headers in the store, which also persists the headers added later.
+// The best chain is the one stored, so that a branch tied with it does not take its place.
+func Load(genesis message.BlockHeader, hash message.Hash, s store.Store) (*Chain, error) {
+	c := New(genesis, hash)
+	var headers []message.BlockHeader
+	err := s.ForEachHeader(func(h *message.BlockHeader) error {
+		headers = append(headers, *h)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not load headers: %v", err)
+	}
+	// Parents first. The headers were validated before they were stored.
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].Height < headers[j].Height })
+	for i := range headers {
+		if err := c.add(&headers[i], headers[i].Hash()); err != nil {
+			return nil, fmt.Errorf("could not load header at height %v: %w", headers[i].Height, err)
+		}
+	}
+	if err := c.loadBest(s); err != nil {
+		return nil, err
+	}
+	c.store = s
+	return c, nil
+}
+
+// loadBest makes the best chain the one in the stored index by height.
+// A branch with more total difficulty than the stored one is still switched to.
+func (c *Chain) loadBest(s store.Store) error {
+	height, err := s.Height()
+	if err != nil {
+		return fmt.Errorf("could not load height: %v", err)
+	}
+	if height == 0 {
+		return nil
+	}
+	best := c.best[:1:1]
+	for h := uint64(1); h <= height; h++ {
+		hash, err := s.HashAt(h)
+		if err != nil {
+			return fmt.Errorf("could not load hash at height %v: %v", h, err)
+		}
+		e, ok := c.headers[hash]
+		if !ok || e.header.Height != h || e.header.Previous != best[h-1].hash {
+			return fmt.Errorf("%w: stored best chain at height %v", ErrNotFound, h)
+		}
+		best = append(best, e)
+	}
+	c.best = best
+	for hash := range c.tips {
+		if e := c.headers[hash]; e.header.TotalDifficulty > c.head().header.TotalDifficulty {
+			c.switchTo(e)
+		}
+	}
+	return nil
+}
+
+// OnReorg registers a function called after every reorg, outside of any lock.
+func (c *Chain) OnReorg(f func(Reorg)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReorg = append(c.onReorg, f)
+}
+
+// Head returns the header at the head of the best chain and its hash.
+func (c *Chain) Head() (message.BlockHeader, message.Hash) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e := c.head()
+	return e.header, e.hash
+}
+
+// head returns the head of the best chain. The caller must hold mu.
+func (c *Chain) head() *entry {
+	return c.best[len(c.best)-1]
+}
+
+// Height returns the height of the head of the best chain.
+func (c *Chain) Height() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return uint64(len(c.best) - 1)
+}
+
+// TotalDifficulty returns the total difficulty of the head of the best chain.
+func (c *Chain) TotalDifficulty() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.head().header.TotalDifficulty
+}
+
+// HashAt returns the hash of the header at the height on the best chain.
+func (c *Chain) HashAt(height uint64) (message.Hash, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if height >= uint64(len(c.best)) {
+		return message.Hash{}, fmt.Errorf("%w: height %v", ErrNotFound, height)
+	}
+	return c.best[height].hash, nil
+}
+
+// HeaderAt returns the header at the height on the best chain.
+func (c *Chain) HeaderAt(height uint64) (message.BlockHeader, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if height >= uint64(len(c.best)) {
+		return message.BlockHeader{}, fmt.Errorf("%w: height %v", ErrNotFound, height)
+	}
+	return c.best[height].header, nil
+}
+
+// Header returns the header with the hash on any branch.
+func (c *Chain) Header(hash message.Hash) (message.BlockHeader, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.headers[hash]
+	if !ok {
+		return message.BlockHeader{}, fmt.Errorf("%w: %v", ErrNotFound, hash)
+	}
+	return e.header, nil
+}
+
+// Has returns true if the header with the hash is known on any branch.
+func (c *Chain) Has(hash message.Hash) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.headers[hash]
+	return ok
+}
+
+// OnBest returns true if the header with the hash is on the best chain.
+func (c *Chain) OnBest(hash message.Hash) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.onBest(hash)
+}
+
+// onBest is OnBest with mu held.
+func (c *Chain) onBest(hash message.Hash) bool {
+	e, ok := c.headers[hash]
+	return ok && e.header.Height < uint64(len(c.best)) && c.best[e.header.Height] == e
+}
+
+// Tips returns the heads of every branch, including the best chain.
+func (c *Chain) Tips() []BlockID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tips := make([]BlockID, 0, len(c.tips))
+	for hash := range c.tips {
+		tips = append(tips, BlockID{Hash: hash, Height: c.headers[hash].header.Height})
+	}
+	return tips
+}
+
+// Locator returns a locator for the best chain.
+func (c *Chain) Locator() (message.Locator, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return message.NewLocator(uint64(len(c.best)-1), func(height uint64) (message.Hash, error) {
+		return c.best[height].hash, nil
+	})
+}
+
+// AddHeaders validates and adds the headers and returns the number of headers added.
+// Headers already known are skipped. Adding stops at the first header that cannot be added.
+// The error is a *validation.Error if a header breaks the rules.
+// If a branch gets more total difficulty than the best chain, it becomes the best chain.
+func (c *Chain) AddHeaders(headers []message.BlockHeader) (int, error) {
+	c.mu.Lock()
+	oldHead := c.head()
+	var added []*message.BlockHeader
+	var err error
+	for i := range headers {
+		h := &headers[i]
+		hash := h.Hash()
+		if _, ok := c.headers[hash]; ok {
+			continue
+		}
+		if _, ok := c.headers[h.Previous]; !ok {
+			err = fmt.Errorf("could not add header %v at height %v: %w: %v", hash, h.Height, ErrOrphan, h.Previous)
+			break
+		}
+		if err = c.Rules.Validate(h, hash, lockedHeaders{c}, time.Now()); err != nil {
+			break
+		}
+		if err = c.add(h, hash); err != nil {
+			err = fmt.Errorf("could not add header %v at height %v: %w", hash, h.Height, err)
+			break
+		}
+		added = append(added, h)
+	}
+	if c.store != nil && len(added) > 0 {
+		if serr := c.persist(added, c.ancestor(oldHead)); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	var reorgs []Reorg
+	if newHead := c.head(); newHead != oldHead && !c.onBest(oldHead.hash) {
+		ancestor := c.ancestor(oldHead)
+		reorgs = append(reorgs, Reorg{
+			Old:      BlockID{Hash: oldHead.hash, Height: oldHead.header.Height},
+			New:      BlockID{Hash: newHead.hash, Height: newHead.header.Height},
+			Ancestor: BlockID{Hash: ancestor.hash, Height: ancestor.header.Height},
+		})
+	}
+	onReorg := c.onReorg
+	c.mu.Unlock()
+	for _, r := range reorgs {
+		for _, f := range onReorg {
+			f(r)
+		}
+	}
+	return len(added), err
+}
+
+// persist stores the added headers and the best chain above the ancestor in one batch.
+// The caller must hold mu.
+func (c *Chain) persist(added []*message.BlockHeader, ancestor *entry) error {
+	err := c.store.Update(func(b store.Batch) error {
+		for _, h := range added {
+			if err := b.PutHeader(h); err != nil {
+				return err
+			}
+		}
+		for _, e := range c.best[ancestor.header.Height+1:] {
+			if err := b.SetHashAt(e.header.Height, e.hash); err != nil {
+				return err
+			}
+		}
+		return b.Truncate(c.head().header.Height)
+	})
+	if err != nil {
+		return fmt.Errorf("could not store headers: %v", err)
+	}
+	return nil
+}
+
+// add adds the valid header and switches the best chain to its branch if it has more total difficulty.
+// The caller must hold mu.
+func (c *Chain) add(h *message.BlockHeader, hash message.Hash) error {
+	parent, ok := c.headers[h.Previous]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrOrphan, h.Previous)
+	}
+	// Stored headers are not validated again, but the best chain relies on these.
+	if h.Height != parent.header.Height+1 {
+		return fmt.Errorf("%w: %v after %v", validation.ErrHeight, h.Height, parent.header.Height)
+	}
+	if h.TotalDifficulty <= parent.header.TotalDifficulty {
+		return fmt.Errorf("%w: %v after %v", validation.ErrDifficulty, h.TotalDifficulty, parent.header.TotalDifficulty)
+	}
+	e := &entry{header: *h, hash: hash}
+	c.headers[hash] = e
+	delete(c.tips, parent.hash)
+	c.tips[hash] = struct{}{}
+	if h.TotalDifficulty > c.head().header.TotalDifficulty {
+		c.switchTo(e)
+	}
+	return nil
+}
+
+// switchTo makes the branch ending with the header the best chain. The caller must hold mu.
+func (c *Chain) switchTo(e *entry) {
+	ancestor := c.ancestor(e)
+	c.best = c.best[:ancestor.header.Height+1]
+	branch := make([]*entry, e.header.Height-ancestor.header.Height)
+	for i := len(branch) - 1; i >= 0; i-- {
+		branch[i] = e
+		e = c.headers[e.header.Previous]
+	}
+	c.best = append(c.best, branch...)
+}
+
+// ancestor returns the last header on the best chain from which the header descends.
+// The caller must hold mu.
+func (c *Chain) ancestor(e *entry) *entry {
+	for !c.onBest(e.hash) {
+		e = c.headers[e.header.Previous]
+	}
+	return e
+}
+
+// lockedHeaders looks up the headers of the chain while mu is held.
+type lockedHeaders struct {
+	c *Chain
+}
+
+// Header returns the header with the hash on any branch.
+func (l lockedHeaders) Header(hash message.Hash) (message.BlockHeader, error) {
+	e, ok := l.c.headers[hash]
+	if !ok {
+		return message.BlockHeader{}, fmt.Errorf("%w: %v", ErrNotFound, hash)
+	}
+	return e.header, nil
+}
@@ -0,0 +1,234 @@
+package chain
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/store"
+	"github.com/zkirill/gringo/validation"
+)
+
+// testGenesis returns a genesis header and its hash.
+func testGenesis() (message.BlockHeader, message.Hash) {
+	h := message.BlockHeader{
+		Version:         1,
+		Timestamp:       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		TotalDifficulty: 1,
+		ProofOfWork:     message.Proof{Nonces: make([]uint32, message.ProofSize)},
+	}
+	return h, h.Hash()
+}
+
+// testHeaders returns n headers extending the parent, each adding the difficulty.
+func testHeaders(parent message.BlockHeader, n int, difficulty uint64) []message.BlockHeader {
+	headers := make([]message.BlockHeader, n)
+	for i := range headers {
+		h := parent
+		h.Height = parent.Height + 1
+		h.Previous = parent.Hash()
+		h.Timestamp = parent.Timestamp.Add(time.Minute)
+		h.TotalDifficulty = parent.TotalDifficulty + difficulty
+		headers[i] = h
+		parent = h
+	}
+	return headers
+}
+
+func TestAddHeaders(t *testing.T) {
+	genesis, hash := testGenesis()
+	c := New(genesis, hash)
+	headers := testHeaders(genesis, 30, 10)
+	if n, err := c.AddHeaders(headers[:20]); err != nil || n != 20 {
+		t.Fatalf("could not add headers: %v added, %v", n, err)
+	}
+	// Known headers are skipped.
+	if n, err := c.AddHeaders(headers[10:]); err != nil || n != 10 {
+		t.Fatalf("could not add headers: %v added, %v", n, err)
+	}
+	head, headHash := c.Head()
+	if c.Height() != 30 || head.Height != 30 || headHash != headers[29].Hash() {
+		t.Errorf("wrong head at height %v: %v", c.Height(), headHash)
+	}
+	if got := c.TotalDifficulty(); got != 301 {
+		t.Errorf("wrong total difficulty: expecting 301, got %v", got)
+	}
+	if h, err := c.HashAt(0); err != nil || h != hash {
+		t.Errorf("wrong genesis hash: %v, %v", h, err)
+	}
+	if _, err := c.HashAt(31); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error: %v", err)
+	}
+	l, err := c.Locator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Hashes[0] != headHash || l.Hashes[len(l.Hashes)-1] != hash {
+		t.Errorf("wrong locator: %v", l.Hashes)
+	}
+}
+
+func TestAddHeadersErrors(t *testing.T) {
+	genesis, hash := testGenesis()
+	headers := testHeaders(genesis, 2, 10)
+	badHeight := testHeaders(genesis, 1, 10)
+	badHeight[0].Height = 5
+	badDifficulty := testHeaders(genesis, 1, 0)
+	tests := []struct {
+		name    string
+		headers []message.BlockHeader
+		want    error
+	}{
+		{"orphan", headers[1:], ErrOrphan},
+		{"height", badHeight, validation.ErrHeight},
+		{"difficulty", badDifficulty, validation.ErrDifficulty},
+	}
+	for _, tt := range tests {
+		c := New(genesis, hash)
+		if _, err := c.AddHeaders(tt.headers); !errors.Is(err, tt.want) {
+			t.Errorf("%v: wrong error: expecting %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestReorg(t *testing.T) {
+	genesis, hash := testGenesis()
+	c := New(genesis, hash)
+	var reorgs []Reorg
+	c.OnReorg(func(r Reorg) { reorgs = append(reorgs, r) })
+	a := testHeaders(genesis, 5, 10)
+	if _, err := c.AddHeaders(a); err != nil {
+		t.Fatal(err)
+	}
+	// A branch from height 2 that overtakes with its second header.
+	b := testHeaders(a[1], 2, 20)
+	if _, err := c.AddHeaders(b[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, head := c.Head(); head != a[4].Hash() || len(reorgs) != 0 || len(c.Tips()) != 2 {
+		t.Fatalf("lighter branch became best: head %v, %v reorgs, %v tips", head, len(reorgs), len(c.Tips()))
+	}
+	if c.OnBest(b[0].Hash()) || !c.Has(b[0].Hash()) {
+		t.Error("lighter branch not kept aside")
+	}
+	if _, err := c.AddHeaders(b[1:]); err != nil {
+		t.Fatal(err)
+	}
+	want := Reorg{
+		Old:      BlockID{Hash: a[4].Hash(), Height: 5},
+		New:      BlockID{Hash: b[1].Hash(), Height: 4},
+		Ancestor: BlockID{Hash: a[1].Hash(), Height: 2},
+	}
+	if len(reorgs) != 1 || reorgs[0] != want {
+		t.Fatalf("wrong reorgs: expecting %+v, got %+v", want, reorgs)
+	}
+	if c.Height() != 4 || c.TotalDifficulty() != 61 {
+		t.Errorf("wrong best chain: height %v, total difficulty %v", c.Height(), c.TotalDifficulty())
+	}
+	if h, _ := c.HashAt(3); h != b[0].Hash() {
+		t.Errorf("wrong hash at height 3: %v", h)
+	}
+	if c.OnBest(a[2].Hash()) {
+		t.Error("old branch still best")
+	}
+	// Extending the best chain is not a reorg.
+	if _, err := c.AddHeaders(testHeaders(b[1], 1, 10)); err != nil || len(reorgs) != 1 {
+		t.Errorf("extension reported as reorg: %v, %v", err, reorgs)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	genesis, hash := testGenesis()
+	path := filepath.Join(t.TempDir(), "gringo.db")
+	s, err := store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(genesis, hash, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := testHeaders(genesis, 5, 10)
+	// Switch to a shorter branch with more work.
+	b := testHeaders(a[1], 1, 100)
+	if _, err := c.AddHeaders(append(a, b...)); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	s, err = store.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if height, err := s.Height(); err != nil || height != 3 {
+		t.Errorf("wrong stored height: %v, %v", height, err)
+	}
+	loaded, err := Load(genesis, hash, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, head := loaded.Head(); head != b[0].Hash() || len(loaded.Tips()) != 2 {
+		t.Errorf("wrong loaded chain: head %v, %v tips", head, len(loaded.Tips()))
+	}
+}
+
+func TestLoadTie(t *testing.T) {
+	genesis, hash := testGenesis()
+	a := testHeaders(genesis, 3, 10)
+	b := testHeaders(genesis, 3, 10)
+	for i := range b {
+		b[i].Nonce = 1
+		if i > 0 {
+			b[i].Previous = b[i-1].Hash()
+		}
+	}
+	// The branch seen first stays best after a restart, whatever the order in which the headers are loaded.
+	for _, branches := range [][2][]message.BlockHeader{{a, b}, {b, a}} {
+		path := filepath.Join(t.TempDir(), "gringo.db")
+		s, err := store.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := Load(genesis, hash, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, headers := range branches {
+			if _, err := c.AddHeaders(headers); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := branches[0][2].Hash()
+		s.Close()
+		if s, err = store.Open(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(genesis, hash, s)
+		s.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, head := loaded.Head(); head != want || len(loaded.Tips()) != 2 {
+			t.Errorf("wrong loaded chain: expecting head %v, got %v with %v tips", want, head, len(loaded.Tips()))
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	genesis, hash := testGenesis()
+	s, err := store.Open(filepath.Join(t.TempDir(), "gringo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	bad := testHeaders(genesis, 1, 10)
+	bad[0].Height = 5
+	if err := s.Update(func(b store.Batch) error { return b.PutHeader(&bad[0]) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(genesis, hash, s); !errors.Is(err, validation.ErrHeight) {
+		t.Errorf("wrong error: expecting %v, got %v", validation.ErrHeight, err)
+	}
+}
@@ -2,25 +2,135 @@
 package handshake
 
 import (
-	"github.com/golang/glog"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
 	"github.com/zkirill/gringo/message"
 )
 
-// NewHandshake new handshake returns a new handshake.
-func NewHandshake() ([]byte, error) {
-	hand, err := message.NewHand()
+// DefaultTimeout is the time allowed for the handshake when none is configured.
+const DefaultTimeout = 10 * time.Second
+
+// ErrTimeout is returned when the peer did not complete the handshake in time.
+var ErrTimeout = errors.New("handshake timed out")
+
+// PeerInfo is what was negotiated with a peer during the handshake.
+type PeerInfo struct {
+	// Version is the protocol version of the peer.
+	Version message.ProtocolVersion
+	// Capabilities are the capabilities of the peer.
+	Capabilities message.Capabilities
+	// TotalDifficulty is the total difficulty of the chain of the peer.
+	TotalDifficulty uint64
+	// UserAgent is the user agent of the peer.
+	UserAgent string
+	// Genesis is the hash of the genesis block of the chain of the peer.
+	Genesis message.Hash
+	// Addr is the address of the peer.
+	Addr message.SockAddr
+	// Inbound is true if the peer connected to us.
+	Inbound bool
+}
+
+// NewHandshake returns the hand part of the handshake from the local to the remote address, encoded with its header.
+func NewHandshake(local, remote *net.TCPAddr, c Config) (*message.Hand, []byte, error) {
+	hand, err := message.NewHand(message.NewSockAddr(local), message.NewSockAddr(remote), c.TotalDifficulty, c.Genesis)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	hand.Capabilities = c.Capabilities
+	var b bytes.Buffer
+	if err := message.WriteMessage(&b, hand); err != nil {
+		return nil, nil, err
+	}
+	return hand, b.Bytes(), nil
+}
+
+// Initiate performs the handshake on an outbound connection.
+// It sends the hand, waits for the shake and checks that the peer is on our chain.
+func Initiate(conn net.Conn, c Config) (*PeerInfo, error) {
+	remote, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("not a TCP connection: %v", conn.RemoteAddr())
+	}
+	local, _ := conn.LocalAddr().(*net.TCPAddr)
+	if local == nil {
+		local = &net.TCPAddr{IP: net.IPv4zero}
 	}
-	len := hand.Len()
-	header, err := message.NewHeader(message.MsgTypeHand, uint64(len))
+	if c.ListenPort != 0 {
+		local = &net.TCPAddr{IP: local.IP, Port: int(c.ListenPort), Zone: local.Zone}
+	}
+	hand, b, err := NewHandshake(local, remote, c)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not compose hand: %v", err)
+	}
+	if c.Nonces != nil {
+		c.Nonces.Add(hand.Nonce)
 	}
-	n, err := header.Write(hand.Bytes())
+	var info *PeerInfo
+	err = withDeadline(conn, c.Timeout, func() error {
+		if _, err := conn.Write(b); err != nil {
+			return fmt.Errorf("could not write hand: %w", err)
+		}
+		m, err := message.ReadMessage(conn)
+		if err != nil {
+			return fmt.Errorf("could not read shake: %w", err)
+		}
+		shake, ok := m.(*message.Shake)
+		if !ok {
+			return fmt.Errorf("%w: %v", ErrUnexpectedMessage, m.Type())
+		}
+		if !SupportedVersion(shake.Version) {
+			return fmt.Errorf("%w: %v", ErrUnsupportedVersion, shake.Version)
+		}
+		if shake.Hash != c.Genesis {
+			return fmt.Errorf("%w: got %v, expecting %v", ErrGenesisMismatch, shake.Hash, c.Genesis)
+		}
+		if !shake.Capabilities.Has(c.RequiredCapabilities) {
+			return fmt.Errorf("%w: got %v, expecting %v", ErrCapabilityMismatch, shake.Capabilities, c.RequiredCapabilities)
+		}
+		info = &PeerInfo{
+			Version:         shake.Version,
+			Capabilities:    shake.Capabilities,
+			TotalDifficulty: shake.TotalDifficulty,
+			UserAgent:       shake.UserAgent,
+			Genesis:         shake.Hash,
+			Addr:            message.NewSockAddr(remote),
+		}
+		return nil
+	})
 	if err != nil {
+		// Our own responder drops the connection when it receives our hand.
+		if c.Nonces != nil && c.Nonces.isSelf(hand.Nonce) {
+			return nil, ErrSelfConnection
+		}
 		return nil, err
 	}
-	glog.Infof("add %v bytes to buffer", n)
-	return header.Bytes(), nil
+	return info, nil
+}
+
+// withDeadline runs f with the deadline of the connection set to the timeout.
+// Timeouts are reported as ErrTimeout.
+func withDeadline(conn net.Conn, timeout time.Duration, f func() error) error {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("could not set deadline: %v", err)
+	}
+	err := f()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("could not clear deadline: %v", err)
+	}
+	return nil
 }
@@ -1,12 +1,122 @@
 package handshake
 
 import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/message"
 )
 
+// tcpPipe returns both ends of a loopback TCP connection.
+func tcpPipe(t *testing.T) (client, server net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
 func TestMakeHandshake(t *testing.T) {
-	_, err := NewHandshake()
+	local := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 13414}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 13414}
+	c := Config{Genesis: message.GenesisHash(), TotalDifficulty: 1000}
+	hand, b, err := NewHandshake(local, remote, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := message.ReadMessage(bytes.NewReader(b))
 	if err != nil {
 		t.Fatal(err)
 	}
+	if !reflect.DeepEqual(m, hand) {
+		t.Errorf("wrong hand: expecting %v, got %v", hand, m)
+	}
+	if hand.TotalDifficulty != 1000 || hand.Hash != message.GenesisHash() {
+		t.Errorf("wrong total difficulty or genesis: %v, %v", hand.TotalDifficulty, hand.Hash)
+	}
+}
+
+func TestInitiateAccept(t *testing.T) {
+	client, server := tcpPipe(t)
+	accepted := make(chan error, 1)
+	go func() {
+		c := Config{Genesis: message.GenesisHash(), TotalDifficulty: 20}
+		info, err := Accept(server, c)
+		if err == nil && (!info.Inbound || info.TotalDifficulty != 10) {
+			err = errors.New("wrong peer info for inbound peer")
+		}
+		accepted <- err
+	}()
+	c := Config{Genesis: message.GenesisHash(), TotalDifficulty: 10}
+	info, err := Initiate(client, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-accepted; err != nil {
+		t.Fatal(err)
+	}
+	if info.Inbound || info.TotalDifficulty != 20 || info.Genesis != message.GenesisHash() || info.Version != message.ProtocolVersion1 {
+		t.Errorf("wrong peer info: %v", info)
+	}
+}
+
+func TestInitiateInvalid(t *testing.T) {
+	tests := []struct {
+		shake *message.Shake
+		err   error
+	}{
+		{message.NewShake(0, 1, message.ZeroHash()), ErrGenesisMismatch},
+		{&message.Shake{Version: message.ProtocolVersion1 + 1, Hash: message.GenesisHash()}, ErrUnsupportedVersion},
+		{message.NewShake(message.HeaderHistCapabilities, 1, message.GenesisHash()), ErrCapabilityMismatch},
+		{nil, ErrTimeout},
+	}
+	for _, test := range tests {
+		client, server := tcpPipe(t)
+		go func(shake *message.Shake) {
+			// Read the hand and reply with the shake.
+			if _, err := message.ReadMessage(server); err != nil || shake == nil {
+				return
+			}
+			message.WriteMessage(server, shake)
+		}(test.shake)
+		c := Config{Genesis: message.GenesisHash(), RequiredCapabilities: message.PeerListCapabilities, Timeout: 100 * time.Millisecond}
+		if _, err := Initiate(client, c); !errors.Is(err, test.err) {
+			t.Errorf("wrong error: expecting %v, got %v", test.err, err)
+		}
+	}
+}
+
+func TestSelfConnection(t *testing.T) {
+	client, server := tcpPipe(t)
+	var nonces Nonces
+	c := Config{Genesis: message.GenesisHash(), Nonces: &nonces, Timeout: time.Second}
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := Accept(server, c)
+		accepted <- err
+		server.Close()
+	}()
+	if _, err := Initiate(client, c); !errors.Is(err, ErrSelfConnection) {
+		t.Errorf("wrong error from initiator: expecting %v, got %v", ErrSelfConnection, err)
+	}
+	if err := <-accepted; !errors.Is(err, ErrSelfConnection) {
+		t.Errorf("wrong error from responder: expecting %v, got %v", ErrSelfConnection, err)
+	}
 }
@@ -0,0 +1,166 @@
+package handshake
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+)
+
+var (
+	// ErrUnsupportedVersion is returned when the peer speaks a protocol version that we do not.
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+	// ErrGenesisMismatch is returned when the peer is on a chain with a different genesis.
+	ErrGenesisMismatch = errors.New("genesis mismatch")
+	// ErrSelfConnection is returned when we connected to ourselves.
+	ErrSelfConnection = errors.New("connection to self")
+	// ErrUnexpectedMessage is returned when the peer sends a message other than the expected part of the handshake.
+	ErrUnexpectedMessage = errors.New("unexpected message during handshake")
+	// ErrCapabilityMismatch is returned when the peer lacks capabilities that we require.
+	ErrCapabilityMismatch = errors.New("missing required capabilities")
+)
+
+// maxNonces is the number of nonces of sent hands that are remembered.
+const maxNonces = 100
+
+// Nonces remembers the nonces of the hands that we sent to detect connections to self.
+// The zero value is ready to use.
+type Nonces struct {
+	mu sync.Mutex
+	// nonces are true once the hand was received back by us.
+	nonces map[uint64]bool
+	// order holds the nonces from the oldest to the newest.
+	order []uint64
+}
+
+// Add remembers the nonce. The oldest nonce is forgotten once there are too many.
+func (n *Nonces) Add(nonce uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.nonces == nil {
+		n.nonces = make(map[uint64]bool)
+	}
+	if _, ok := n.nonces[nonce]; ok {
+		return
+	}
+	if len(n.order) == maxNonces {
+		delete(n.nonces, n.order[0])
+		n.order = n.order[1:]
+	}
+	n.nonces[nonce] = false
+	n.order = append(n.order, nonce)
+}
+
+// Has returns true if the nonce was sent by us.
+func (n *Nonces) Has(nonce uint64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.nonces[nonce]
+	return ok
+}
+
+// markSelf records that the hand with the nonce was received by us.
+func (n *Nonces) markSelf(nonce uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.nonces[nonce]; ok {
+		n.nonces[nonce] = true
+	}
+}
+
+// isSelf returns true if the hand with the nonce was received by us.
+func (n *Nonces) isSelf(nonce uint64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.nonces[nonce]
+}
+
+// Config holds our side of the handshake.
+type Config struct {
+	// Genesis is the hash of the genesis block of our chain.
+	Genesis message.Hash
+	// TotalDifficulty is the total difficulty of our chain.
+	TotalDifficulty uint64
+	// Capabilities are our capabilities.
+	Capabilities message.Capabilities
+	// RequiredCapabilities are the capabilities that peers must have.
+	RequiredCapabilities message.Capabilities
+	// Nonces are the nonces of the hands we sent. It may be nil.
+	Nonces *Nonces
+	// ListenPort is the port on which we accept peers, sent in the hand.
+	// The local port of the connection is sent if zero.
+	ListenPort uint16
+	// Timeout is the time allowed for the handshake. DefaultTimeout is used if zero.
+	Timeout time.Duration
+}
+
+// SupportedVersion returns true if we speak the protocol version.
+func SupportedVersion(v message.ProtocolVersion) bool {
+	return v == message.ProtocolVersion1
+}
+
+// Accept performs the handshake on an inbound connection.
+// It waits for the hand and replies with a shake if the peer is on our chain.
+func Accept(conn net.Conn, c Config) (*PeerInfo, error) {
+	var info *PeerInfo
+	err := withDeadline(conn, c.Timeout, func() error {
+		m, err := message.ReadMessage(conn)
+		if err != nil {
+			return fmt.Errorf("could not read hand: %w", err)
+		}
+		hand, ok := m.(*message.Hand)
+		if !ok {
+			return fmt.Errorf("%w: %v", ErrUnexpectedMessage, m.Type())
+		}
+		if _, err := Respond(conn, hand, c); err != nil {
+			return err
+		}
+		addr := hand.SenderAddr
+		if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			// The peer listens on the port it sent but connects from the address we see.
+			addr = message.NewSockAddr(&net.TCPAddr{IP: remote.IP, Port: int(hand.SenderAddr.Port), Zone: remote.Zone})
+		}
+		info = &PeerInfo{
+			Version:         hand.Version,
+			Capabilities:    hand.Capabilities,
+			TotalDifficulty: hand.TotalDifficulty,
+			UserAgent:       hand.UserAgent,
+			Genesis:         hand.Hash,
+			Addr:            addr,
+			Inbound:         true,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Respond validates the hand received from a peer and writes the shake in reply.
+// Nothing is written if the hand is not valid.
+func Respond(w io.Writer, hand *message.Hand, c Config) (*message.Shake, error) {
+	if !SupportedVersion(hand.Version) {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedVersion, hand.Version)
+	}
+	if hand.Hash != c.Genesis {
+		return nil, fmt.Errorf("%w: got %v, expecting %v", ErrGenesisMismatch, hand.Hash, c.Genesis)
+	}
+	if c.Nonces != nil && c.Nonces.Has(hand.Nonce) {
+		// Let the outbound side of the connection know as well.
+		c.Nonces.markSelf(hand.Nonce)
+		return nil, ErrSelfConnection
+	}
+	if !hand.Capabilities.Has(c.RequiredCapabilities) {
+		return nil, fmt.Errorf("%w: got %v, expecting %v", ErrCapabilityMismatch, hand.Capabilities, c.RequiredCapabilities)
+	}
+	shake := message.NewShake(c.Capabilities, c.TotalDifficulty, c.Genesis)
+	if err := message.WriteMessage(w, shake); err != nil {
+		return nil, fmt.Errorf("could not write shake: %w", err)
+	}
+	return shake, nil
+}
@@ -0,0 +1,103 @@
+package handshake
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/zkirill/gringo/message"
+)
+
+func testHand(t *testing.T) *message.Hand {
+	addr := message.NewSockAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 13414})
+	hand, err := message.NewHand(addr, addr, 10, message.GenesisHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hand
+}
+
+func TestAccept(t *testing.T) {
+	client, server := tcpPipe(t)
+	hand := testHand(t)
+	if err := message.WriteMessage(client, hand); err != nil {
+		t.Fatal(err)
+	}
+	c := Config{Genesis: message.GenesisHash(), TotalDifficulty: 20}
+	info, err := Accept(server, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UserAgent != hand.UserAgent || info.Addr.Port != hand.SenderAddr.Port {
+		t.Errorf("wrong peer info: %v", info)
+	}
+	// The shake was written in reply.
+	m, err := message.ReadMessage(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shake, ok := m.(*message.Shake)
+	if !ok {
+		t.Fatalf("expecting shake, got %v", m.Type())
+	}
+	if shake.TotalDifficulty != 20 || shake.Hash != message.GenesisHash() || shake.Version != message.ProtocolVersion1 {
+		t.Errorf("wrong shake: %v", shake)
+	}
+}
+
+func TestAcceptUnexpectedMessage(t *testing.T) {
+	client, server := tcpPipe(t)
+	if err := message.WriteMessage(client, &message.Ping{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Accept(server, Config{}); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrUnexpectedMessage, err)
+	}
+}
+
+func TestRespondInvalid(t *testing.T) {
+	var nonces Nonces
+	c := Config{Genesis: message.GenesisHash(), Nonces: &nonces}
+	// Wrong version.
+	hand := testHand(t)
+	hand.Version++
+	var b bytes.Buffer
+	if _, err := Respond(&b, hand, c); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrUnsupportedVersion, err)
+	}
+	// Wrong genesis.
+	hand = testHand(t)
+	hand.Hash = message.ZeroHash()
+	if _, err := Respond(&b, hand, c); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrGenesisMismatch, err)
+	}
+	// Our own hand.
+	hand = testHand(t)
+	nonces.Add(hand.Nonce)
+	if _, err := Respond(&b, hand, c); !errors.Is(err, ErrSelfConnection) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrSelfConnection, err)
+	}
+	// Missing capabilities.
+	hand = testHand(t)
+	c.RequiredCapabilities = message.PeerListCapabilities
+	if _, err := Respond(&b, hand, c); !errors.Is(err, ErrCapabilityMismatch) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrCapabilityMismatch, err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("wrote %v bytes in reply to invalid hands", b.Len())
+	}
+}
+
+func TestNonces(t *testing.T) {
+	var n Nonces
+	for i := uint64(0); i <= maxNonces; i++ {
+		n.Add(i)
+	}
+	if n.Has(0) {
+		t.Error("oldest nonce was not forgotten")
+	}
+	if !n.Has(1) || !n.Has(maxNonces) {
+		t.Error("nonce was forgotten")
+	}
+}
@@ -1,163 +1,235 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"strconv"
 
 	"github.com/golang/glog"
+	"github.com/zkirill/gringo/addrbook"
+	"github.com/zkirill/gringo/chain"
 	"github.com/zkirill/gringo/handshake"
 	"github.com/zkirill/gringo/message"
-	"github.com/zkirill/gringo/seeds"
+	"github.com/zkirill/gringo/params"
+	"github.com/zkirill/gringo/peer"
+	"github.com/zkirill/gringo/store"
+	"github.com/zkirill/gringo/syncer"
+	"github.com/zkirill/gringo/validation"
 )
 
-// port is the port on which we connect to the seed.
-const port = 13414
+// network is the name of the network to connect to.
+var network = flag.String("network", params.Testnet2.Name, fmt.Sprintf("network to connect to, one of %v", params.Names()))
+
+// outbound is the number of outbound connections to keep.
+var outbound = flag.Int("outbound", peer.DefaultOutbound, "number of outbound connections to keep")
+
+// listen is true if peers may connect to us.
+var listen = flag.Bool("listen", true, "accept connections from peers")
+
+// port is the port on which peers are accepted. The port of the network is used if zero.
+var port = flag.Uint("port", 0, "port on which peers are accepted, the port of the network if zero")
+
+// maxInbound is the maximum number of peers that may connect to us.
+var maxInbound = flag.Int("maxinbound", peer.DefaultMaxInbound, "maximum number of inbound connections")
+
+// Connection timeouts.
+var (
+	dialTimeout      = flag.Duration("dialtimeout", peer.DefaultDialTimeout, "time allowed to open a connection")
+	handshakeTimeout = flag.Duration("handshaketimeout", handshake.DefaultTimeout, "time allowed for the handshake")
+	readTimeout      = flag.Duration("readtimeout", peer.DefaultReadTimeout, "time allowed to read a message once it started arriving")
+	writeTimeout     = flag.Duration("writetimeout", peer.DefaultWriteTimeout, "time allowed to write a message")
+	idleTimeout      = flag.Duration("idletimeout", peer.DefaultIdleTimeout, "time allowed between messages from a peer")
+)
+
+// db is the database file in which the chain, the known peer addresses and the bans are kept.
+var db = flag.String("db", "", "database file in which the state is kept, gringo-<network>.db if empty")
+
+// banDuration is how long misbehaving peers are banned.
+var banDuration = flag.Duration("banduration", peer.DefaultBanDuration, "how long misbehaving peers are banned")
 
 func main() {
 	flag.Parse()
-	seed := seeds.Seeds()[1]
-	raddr := net.TCPAddr{
-		IP:   net.ParseIP(seed),
-		Port: port,
+	n, err := params.ByName(*network)
+	if err != nil {
+		glog.Errorf("could not select network: %v", err)
+		return
+	}
+	if err := n.Use(); err != nil {
+		glog.Errorf("could not use network: %v", err)
+		return
 	}
-	con, err := net.DialTCP("tcp", nil, &raddr)
+	// Stop on interrupt.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	var seeds []string
+	for _, seed := range n.Seeds {
+		// Join host and port so that IP v6 seeds are bracketed.
+		seeds = append(seeds, net.JoinHostPort(seed, strconv.Itoa(int(n.Port))))
+	}
+	if *db == "" {
+		*db = fmt.Sprintf("gringo-%v.db", n.Name)
+	}
+	s, err := store.Open(*db)
 	if err != nil {
-		glog.Errorf("could not connect: %v", err)
+		glog.Errorf("could not open database: %v", err)
 		return
 	}
-	glog.Infof("connected")
-	// Send the "hand" part of the handshake.
-	h, err := handshake.NewHandshake()
+	defer s.Close()
+	book, err := addrbook.Open(s)
 	if err != nil {
-		glog.Errorf("could not compose hand part of the handshake: %v", err)
+		glog.Errorf("could not load address book: %v", err)
 		return
 	}
-	n, err := con.Write(h)
+	bans, err := addrbook.OpenBanList(s)
 	if err != nil {
-		glog.Errorf("could not write to connection: %v", err)
+		glog.Errorf("could not load ban list: %v", err)
 		return
 	}
-	glog.Infof("wrote %v bytes", n)
-	// Wait for and read the second "shake" part of the handshake.
-	for {
-		var h message.Header
-		if err := h.Read(con); err != nil {
-			glog.Errorf("could not read header: %v", err)
-			break
+	localChain, err := chain.Load(n.Genesis, n.GenesisHash, s)
+	if err != nil {
+		glog.Errorf("could not load chain: %v", err)
+		return
+	}
+	localChain.Rules = validation.RulesFor(n)
+	glog.Infof("loaded chain at height %v", localChain.Height())
+	var headerSync *syncer.HeaderSync
+	var blocks *syncer.BlockDownloader
+	if *port == 0 {
+		*port = uint(n.Port)
+	}
+	m := peer.NewManager(peer.ManagerConfig{
+		Handshake: handshake.Config{
+			Genesis:      n.GenesisHash,
+			Capabilities: message.PeerListCapabilities,
+			ListenPort:   uint16(*port),
+			Timeout:      *handshakeTimeout,
+		},
+		Timeouts: peer.Timeouts{
+			Dial:  *dialTimeout,
+			Read:  *readTimeout,
+			Write: *writeTimeout,
+			Idle:  *idleTimeout,
+		},
+		Book:        book,
+		Bans:        bans,
+		BanDuration: *banDuration,
+		Chain: func() (uint64, uint64) {
+			return localChain.TotalDifficulty(), localChain.Height()
+		},
+		Handler: func(p *peer.Peer, msg message.Message) {
+			handleMessage(p, msg)
+			headerSync.Handle(p, msg)
+			blocks.Handle(p, msg)
+		},
+		OnConnect:  handleConnect,
+		Outbound:   *outbound,
+		MaxInbound: *maxInbound,
+		Seeds:      seeds,
+	})
+	headerSync = syncer.NewHeaderSync(syncer.Config{Chain: localChain, Peers: m.Peers})
+	go headerSync.Run(ctx)
+	start, err := firstMissingBlock(localChain, s)
+	if err != nil {
+		glog.Errorf("could not find missing blocks: %v", err)
+		return
+	}
+	blocks = syncer.NewBlockDownloader(syncer.BlockConfig{
+		Chain:   localChain,
+		Peers:   m.Peers,
+		Deliver: storeBlock(s),
+		Start:   start,
+	})
+	localChain.OnReorg(func(r chain.Reorg) {
+		glog.Infof("reorg from %v at height %v to %v at height %v, common ancestor at height %v", r.Old.Hash, r.Old.Height, r.New.Hash, r.New.Height, r.Ancestor.Height)
+		blocks.Reorg(r)
+	})
+	go blocks.Run(ctx)
+	if *listen {
+		l, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(int(*port))))
+		if err != nil {
+			glog.Errorf("could not listen: %v", err)
+			return
 		}
-		glog.Infof("read header with magic 1 %v, magic 2 %v, msg len %v, for message type %v", h.Magic1, h.Magic2, h.Length, h.MsgType)
-		switch h.MsgType {
-		case message.MsgTypePing:
-			// Received ping.
-			var m message.Ping
-			if err := m.Read(con); err != nil {
-				glog.Errorf("could not read ping: %v", err)
-				break
-			}
-			glog.Infof("read ping with difficulty %v, height %v", m.TotalDifficulty, m.Height)
-			// Send pong.
-			var p message.Ping
-			// Mirror the sender.
-			p.Height = m.Height
-			p.TotalDifficulty = m.TotalDifficulty
-			if err := p.Write(true, con); err != nil {
-				glog.Errorf("could not send pong: %v", err)
-				break
+		go func() {
+			if err := m.Serve(ctx, l); err != nil && ctx.Err() == nil {
+				glog.Errorf("stopped accepting peers: %v", err)
 			}
-			glog.Info("sent pong")
-		case message.MsgTypeShake:
-			// Received shake.
-			var s message.Shake
-			if err := s.Read(con); err != nil {
-				glog.Errorf("could not read shake: %v", err)
-				break
-			}
-			glog.Infof("read shake from user agent %v", s.UserAgent)
-			// Request peer addresses.
-			// if err := RequestPeerAddrs(con); err != nil {
-			// 	glog.Errorf("could not request peer addrs: %v", err)
-			// 	break
-			// }
-			// Request block headers.
-			if err := RequestBlockHeaders(con); err != nil {
-				glog.Errorf("could not request block headers: %v", err)
-				break
-			}
-		case message.MsgTypePeerAddrs:
-			glog.Infof("msg peer addrs")
-			var v message.PeerAddrs
-			if err := v.Read(con); err != nil {
-				glog.Errorf("could not read peers: %v", err)
-				break
-			}
-			glog.Infof("read %v peer addrs", len(v.Peers))
-			if len(v.Peers) > 0 {
-				glog.Infof("first peer: %v", v.Peers[0])
-			}
-		case message.MsgTypeHeaders:
-			glog.Infof("msg headers")
-			var v message.BlockHeaders
-			if err := v.Read(con); err != nil {
-				glog.Errorf("could not read headers: %v", err)
-				break
-			}
-			glog.Infof("read %v headers", len(v.Headers))
-			if len(v.Headers) > 0 {
-				glog.Infof("first header difficulty: %v", v.Headers[0].TotalDifficulty)
-				glog.Infof("first header nonce: %v", v.Headers[0].Nonce)
-				glog.Infof("first header pow: %v", v.Headers[0].ProofOfWork)
-			}
-		case message.MsgTypeBlock:
-			glog.Infof("msg block")
-			var v message.Block
-			if err := v.Read(con); err != nil {
-				glog.Errorf("could not read block: %v", err)
-				break
-			}
-		default:
-			// Catch all other messages and read to the end.
-			b := make([]byte, h.Length)
-			n, err := con.Read(b)
-			if err != nil {
-				glog.Errorf("could not read message: %v", err)
-				break
-			}
-			glog.Infof("read %v bytes", n)
-		}
+		}()
 	}
-	if err := con.Close(); err != nil {
-		glog.Fatalf("could not close connection: %v", err)
+	glog.Infof("stopped: %v", m.Run(ctx))
+}
+
+// handleConnect handles a new peer.
+func handleConnect(p *peer.Peer) {
+	info := p.Info
+	glog.Infof("handshake with %v, user agent %v, version %v, capabilities %v, total difficulty %v", p, info.UserAgent, info.Version, info.Capabilities, info.TotalDifficulty)
+	// Request peer addresses. Headers are requested by the header sync.
+	if err := RequestPeerAddrs(p, message.FullNodeCapabilities); err != nil {
+		glog.Errorf("could not request peer addrs: %v", err)
 	}
 }
 
-// RequestPeerAddrs requests peer addresses.
-func RequestPeerAddrs(con *net.TCPConn) error {
-	var r message.GetPeerAddrs
-	err := r.Write(con)
-	if err != nil {
-		return fmt.Errorf("could not write to connection: %v", err)
+// handleMessage handles a message received from a peer.
+func handleMessage(p *peer.Peer, msg message.Message) {
+	glog.Infof("read message of type %v, msg len %v", msg.Type(), msg.Len())
+	switch m := msg.(type) {
+	case *message.Ping:
+		// The manager answers with a pong.
+		glog.Infof("read ping with difficulty %v, height %v", m.TotalDifficulty, m.Height)
+	case *message.Pong:
+		glog.Infof("read pong with difficulty %v, height %v, latency %v", m.TotalDifficulty, m.Height, p.Latency())
+	case *message.PeerAddrs:
+		glog.Infof("read %v peer addrs", len(m.Peers))
+		if len(m.Peers) > 0 {
+			glog.Infof("first peer: %v", m.Peers[0])
+		}
+	case *message.BlockHeaders:
+		glog.Infof("read %v headers", len(m.Headers))
+	default:
+		// All other messages are read to the end.
+		glog.Infof("read %v bytes", m.Len())
+	}
+}
+
+// RequestPeerAddrs requests addresses of peers with the capabilities.
+func RequestPeerAddrs(p *peer.Peer, capabilities message.Capabilities) error {
+	r := message.GetPeerAddrs{Capabilities: capabilities}
+	if err := p.Send(&r); err != nil {
+		return fmt.Errorf("could not send to peer: %v", err)
 	}
 	glog.Info("requested peer addresses")
 	return nil
 }
 
-// RequestBlockHeaders requests block headers.
-func RequestBlockHeaders(con *net.TCPConn) error {
-	var r message.GetHeaders
-	err := r.Write(con)
-	if err != nil {
-		return fmt.Errorf("could not write to connection: %v", err)
+// storeBlock returns a function storing the downloaded blocks.
+func storeBlock(s store.Store) func(b *message.Block) error {
+	return func(b *message.Block) error {
+		glog.Infof("downloaded block %v at height %v with %v inputs, %v outputs and %v kernels", b.Hash(), b.Header.Height, len(b.Inputs), len(b.Outputs), len(b.Kernels))
+		return s.Update(func(batch store.Batch) error {
+			return batch.PutBlock(b)
+		})
 	}
-	glog.Info("requested headers")
-	return nil
 }
 
-// RequestBlock requests block headers.
-func RequestBlock(hash message.Hash, con *net.TCPConn) error {
-	if err := message.GetBlock(hash, con); err != nil {
-		return fmt.Errorf("could not write to connection: %v", err)
+// firstMissingBlock returns the height of the first block on the chain that is not stored.
+func firstMissingBlock(c *chain.Chain, s store.Store) (uint64, error) {
+	height := uint64(1)
+	for ; height <= c.Height(); height++ {
+		hash, err := c.HashAt(height)
+		if err != nil {
+			return 0, err
+		}
+		ok, err := s.HasBlock(hash)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
 	}
-	glog.Info("requested block")
-	return nil
+	return height, nil
 }
@@ -9,18 +9,34 @@ import (
 	"github.com/golang/glog"
 )
 
+func init() {
+	Register(MsgTypeGetHeaders, func() Message { return new(GetHeaders) })
+	Register(MsgTypeHeader, func() Message { return new(BlockHeader) })
+	Register(MsgTypeHeaders, func() Message { return new(BlockHeaders) })
+	Register(MsgTypeGetBlock, func() Message { return new(GetBlock) })
+	Register(MsgTypeBlock, func() Message { return new(Block) })
+}
+
 // GetHeaders requests block headers.
 type GetHeaders struct {
 	Locator Locator
 }
 
+// Type returns the get headers message type.
+func (v GetHeaders) Type() MsgType {
+	return MsgTypeGetHeaders
+}
+
+// Read reads message for getting headers.
+func (v *GetHeaders) Read(r io.Reader) error {
+	if err := v.Locator.Read(r); err != nil {
+		return fmt.Errorf("could not read locator: %v", err)
+	}
+	return nil
+}
+
 // Write writes message for getting headers.
 func (v GetHeaders) Write(w io.Writer) error {
-	// Header.
-	var h Header
-	if err := h.Write(MsgTypeGetHeaders, 33, w); err != nil {
-		return fmt.Errorf("could not write header for GetHeaders message: %v", err)
-	}
 	// Locator.
 	if err := v.Locator.Write(w); err != nil {
 		return fmt.Errorf("could not write locator: %v", err)
@@ -28,26 +44,59 @@ func (v GetHeaders) Write(w io.Writer) error {
 	return nil
 }
 
+// Len returns the length of the message body.
+func (v GetHeaders) Len() uint64 {
+	return v.Locator.Len()
+}
+
 // BlockHeaders is a wrapper for headers.
 type BlockHeaders struct {
 	// Headers are headers.
 	Headers []BlockHeader
 }
 
+// Type returns the block headers message type.
+func (v BlockHeaders) Type() MsgType {
+	return MsgTypeHeaders
+}
+
 // BlockHeaders reads headers.
 func (v *BlockHeaders) Read(r io.Reader) error {
 	var len uint16
 	if err := binary.Read(r, binary.BigEndian, &len); err != nil {
 		return err
 	}
+	if len > MaxBlockHeaders {
+		return fmt.Errorf("too many headers: %v", len)
+	}
 	glog.Infof("received %v block headers", len)
 	v.Headers = make([]BlockHeader, len)
 	for i := uint16(0); i < len; i++ {
-		v.Headers[i].Read(r)
+		if err := v.Headers[i].Read(r); err != nil {
+			return fmt.Errorf("could not read header %v: %v", i, err)
+		}
 	}
 	return nil
 }
 
+// Write writes headers.
+func (v BlockHeaders) Write(w io.Writer) error {
+	if err := binary.Write(w, binary.BigEndian, uint16(len(v.Headers))); err != nil {
+		return fmt.Errorf("could not write headers length: %v", err)
+	}
+	for i := range v.Headers {
+		if err := v.Headers[i].Write(w); err != nil {
+			return fmt.Errorf("could not write header %v: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Len returns the length of the encoded headers.
+func (v BlockHeaders) Len() uint64 {
+	return encodedLen(v.Write)
+}
+
 // BlockHeader is the MimbleWimble block header.
 type BlockHeader struct {
 	/// Version is the version of the block.
@@ -77,6 +126,12 @@ type BlockHeader struct {
 	ProofOfWork Proof
 }
 
+// Type returns the block header message type.
+func (v BlockHeader) Type() MsgType {
+	return MsgTypeHeader
+}
+
+// Read reads the block header.
 func (v *BlockHeader) Read(r io.Reader) error {
 	// Version.
 	if err := binary.Read(r, binary.BigEndian, &v.Version); err != nil {
@@ -123,6 +178,77 @@ func (v *BlockHeader) Read(r io.Reader) error {
 	return nil
 }
 
+// Write writes the block header.
+func (v BlockHeader) Write(w io.Writer) error {
+	if err := v.writePrePoW(w); err != nil {
+		return err
+	}
+	// Proof of work.
+	if err := v.ProofOfWork.Write(w); err != nil {
+		return fmt.Errorf("could not write pow: %v", err)
+	}
+	return nil
+}
+
+// writePrePoW writes the part of the block header that precedes the proof of work.
+func (v BlockHeader) writePrePoW(w io.Writer) error {
+	// Version.
+	if err := binary.Write(w, binary.BigEndian, v.Version); err != nil {
+		return err
+	}
+	// Height.
+	if err := binary.Write(w, binary.BigEndian, v.Height); err != nil {
+		return err
+	}
+	// Hash of the previous block to this block in the chain.
+	if err := binary.Write(w, binary.BigEndian, v.Previous); err != nil {
+		return err
+	}
+	// Timestamp.
+	if err := binary.Write(w, binary.BigEndian, v.Timestamp.Unix()); err != nil {
+		return err
+	}
+	// Total difficulty.
+	if err := binary.Write(w, binary.BigEndian, v.TotalDifficulty); err != nil {
+		return err
+	}
+	// Output root.
+	if err := binary.Write(w, binary.BigEndian, v.OutputRoot); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.RangeProofRoot); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.KernelRoot); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, v.TotalKernelOffset); err != nil {
+		return err
+	}
+	// Nonce.
+	if err := binary.Write(w, binary.BigEndian, v.Nonce); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Hash returns the Blake2b-256 hash of the encoded block header, which is also the hash of the block.
+// It has not been checked against headers of the public networks.
+func (v BlockHeader) Hash() Hash {
+	return hashOf(v.Write)
+}
+
+// PrePoWHash returns the hash of the block header without the proof of work, which the proof of work is for.
+func (v BlockHeader) PrePoWHash() Hash {
+	return hashOf(v.writePrePoW)
+}
+
+// Len returns the length of the encoded block header.
+func (v BlockHeader) Len() uint64 {
+	return encodedLen(v.Write)
+}
+
+// Block is a MimbleWimble block.
 type Block struct {
 	// Header contains metadata and commitments to the rest of the data.
 	Header BlockHeader
@@ -134,6 +260,12 @@ type Block struct {
 	Kernels []TxKernel
 }
 
+// Type returns the block message type.
+func (v Block) Type() MsgType {
+	return MsgTypeBlock
+}
+
+// Read reads the block.
 func (v *Block) Read(r io.Reader) error {
 	if err := v.Header.Read(r); err != nil {
 		return fmt.Errorf("could not read block header: %v", err)
@@ -148,45 +280,114 @@ func (v *Block) Read(r io.Reader) error {
 	if err := binary.Read(r, binary.BigEndian, &kernelsLen); err != nil {
 		return fmt.Errorf("could not read kernels length: %v", err)
 	}
+	// Check the lengths against the bytes left before allocating.
+	left := uint64(MaxBlockLen)
+	if lr, ok := r.(*io.LimitedReader); ok && lr.N >= 0 && uint64(lr.N) < left {
+		left = uint64(lr.N)
+	}
+	// The single checks keep the sum from overflowing.
+	if inputsLen > MaxBlockLen/inputLen || outputsLen > MaxBlockLen/outputMinLen || kernelsLen > MaxBlockLen/txKernelLen ||
+		inputsLen*inputLen+outputsLen*outputMinLen+kernelsLen*txKernelLen > left {
+		return fmt.Errorf("too many inputs, outputs or kernels for %v bytes: %v, %v, %v", left, inputsLen, outputsLen, kernelsLen)
+	}
+	// Inputs.
+	v.Inputs = make([]Input, inputsLen)
+	for i := range v.Inputs {
+		if err := v.Inputs[i].Read(r); err != nil {
+			return fmt.Errorf("could not read input %v: %v", i, err)
+		}
+	}
+	// Outputs.
+	v.Outputs = make([]Output, outputsLen)
+	for i := range v.Outputs {
+		if err := v.Outputs[i].Read(r); err != nil {
+			return fmt.Errorf("could not read output %v: %v", i, err)
+		}
+	}
+	// Kernels.
+	v.Kernels = make([]TxKernel, kernelsLen)
+	for i := range v.Kernels {
+		if err := v.Kernels[i].Read(r); err != nil {
+			return fmt.Errorf("could not read kernel %v: %v", i, err)
+		}
+	}
 	return nil
 }
 
-type Input struct {
-	Features OutputFeatures
-	Commit   [33]uint8
+// Hash returns the hash of the block.
+func (v Block) Hash() Hash {
+	return v.Header.Hash()
 }
 
-type Output struct {
-	Features OutputFeatures
-	Commit   [33]uint8
-	Proof    PangeProof
+// Write writes the block.
+func (v Block) Write(w io.Writer) error {
+	if err := v.Header.Write(w); err != nil {
+		return fmt.Errorf("could not write block header: %v", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint64(len(v.Inputs))); err != nil {
+		return fmt.Errorf("could not write inputs length: %v", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint64(len(v.Outputs))); err != nil {
+		return fmt.Errorf("could not write outputs length: %v", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint64(len(v.Kernels))); err != nil {
+		return fmt.Errorf("could not write kernels length: %v", err)
+	}
+	// Inputs.
+	for i := range v.Inputs {
+		if err := v.Inputs[i].Write(w); err != nil {
+			return fmt.Errorf("could not write input %v: %v", i, err)
+		}
+	}
+	// Outputs.
+	for i := range v.Outputs {
+		if err := v.Outputs[i].Write(w); err != nil {
+			return fmt.Errorf("could not write output %v: %v", i, err)
+		}
+	}
+	// Kernels.
+	for i := range v.Kernels {
+		if err := v.Kernels[i].Write(w); err != nil {
+			return fmt.Errorf("could not write kernel %v: %v", i, err)
+		}
+	}
+	return nil
 }
 
-type OutputFeatures uint8
-
-const (
-	DefaultOutputFeatures  OutputFeatures = 0 << 0
-	CoinbaseOutputFeatures OutputFeatures = 0 << 1
-)
+// Len returns the length of the encoded block.
+func (v Block) Len() uint64 {
+	return encodedLen(v.Write)
+}
 
-type PangeProof struct {
-	Proof      [5134]uint8
-	ProofLenth uint
+// GetBlock requests block by hash.
+type GetBlock struct {
+	// Hash is the hash of the requested block.
+	Hash Hash
 }
 
-type TxKernel struct {
+// Type returns the get block message type.
+func (v GetBlock) Type() MsgType {
+	return MsgTypeGetBlock
 }
 
-// GetBlock requests block by hash.
-func GetBlock(hash Hash, w io.Writer) error {
-	// Header.
-	var h Header
-	if err := h.Write(MsgTypeGetBlock, 32, w); err != nil {
-		return fmt.Errorf("could not write header for GetBlock message: %v", err)
+// Read reads the block request.
+func (v *GetBlock) Read(r io.Reader) error {
+	if err := binary.Read(r, binary.BigEndian, &v.Hash); err != nil {
+		return fmt.Errorf("could not read hash: %v", err)
 	}
+	return nil
+}
+
+// Write writes the block request.
+func (v GetBlock) Write(w io.Writer) error {
 	// Block hash.
-	if err := binary.Write(w, binary.BigEndian, &hash); err != nil {
+	if err := binary.Write(w, binary.BigEndian, v.Hash); err != nil {
 		return fmt.Errorf("could not write hash: %v", err)
 	}
 	return nil
 }
+
+// Len returns the length of the block request.
+func (v GetBlock) Len() uint64 {
+	return 32
+}
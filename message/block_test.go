@@ -0,0 +1,173 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadBlock(t *testing.T) {
+	var b bytes.Buffer
+	h := BlockHeader{Height: 1, ProofOfWork: Proof{Nonces: make([]uint32, ProofSize)}}
+	if err := h.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	// One input, one output and one kernel.
+	binary.Write(&b, binary.BigEndian, []uint64{1, 1, 1})
+	// Input.
+	b.WriteByte(uint8(CoinbaseOutputFeatures))
+	b.Write(bytes.Repeat([]byte{1}, CommitmentSize))
+	// Output with a three byte range proof.
+	b.WriteByte(uint8(DefaultOutputFeatures))
+	b.Write(bytes.Repeat([]byte{2}, CommitmentSize))
+	binary.Write(&b, binary.BigEndian, uint64(3))
+	b.Write([]byte{7, 8, 9})
+	// Kernel.
+	b.WriteByte(uint8(CoinbaseKernelFeatures))
+	binary.Write(&b, binary.BigEndian, []uint64{5, 6})
+	b.Write(bytes.Repeat([]byte{3}, CommitmentSize))
+	b.Write(bytes.Repeat([]byte{4}, SignatureSize))
+
+	var v Block
+	r := bytes.NewReader(b.Bytes())
+	if err := v.Read(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 0 {
+		t.Errorf("block not fully read: %v bytes left", r.Len())
+	}
+	if len(v.Inputs) != 1 || len(v.Outputs) != 1 || len(v.Kernels) != 1 {
+		t.Fatalf("wrong number of inputs, outputs or kernels: %v, %v, %v", len(v.Inputs), len(v.Outputs), len(v.Kernels))
+	}
+	if v.Inputs[0].Features != CoinbaseOutputFeatures || v.Inputs[0].Commit[0] != 1 {
+		t.Errorf("wrong input: %v", v.Inputs[0])
+	}
+	if !bytes.Equal(v.Outputs[0].Proof.Proof, []byte{7, 8, 9}) {
+		t.Errorf("wrong range proof: %v", v.Outputs[0].Proof.Proof)
+	}
+	k := v.Kernels[0]
+	if k.Features != CoinbaseKernelFeatures || k.Fee != 5 || k.LockHeight != 6 || k.Excess[0] != 3 || k.ExcessSig[0] != 4 {
+		t.Errorf("wrong kernel: %v", k)
+	}
+}
+
+func TestReadBlockTooManyInputs(t *testing.T) {
+	var b bytes.Buffer
+	h := BlockHeader{ProofOfWork: Proof{Nonces: make([]uint32, ProofSize)}}
+	if err := h.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	header := b.Bytes()
+	tests := []struct {
+		name   string
+		counts []uint64
+		limit  int64
+	}{
+		{"too many inputs", []uint64{1 << 40, 0, 0}, MaxBlockLen},
+		// Each count fits in a block but not all of them together.
+		{"too many in total", []uint64{MaxBlockLen / inputLen, MaxBlockLen / outputMinLen, MaxBlockLen / txKernelLen}, MaxBlockLen},
+		{"more than the message", []uint64{10, 0, 0}, int64(len(header)) + 24 + 9*inputLen},
+	}
+	for _, test := range tests {
+		var body bytes.Buffer
+		body.Write(header)
+		binary.Write(&body, binary.BigEndian, test.counts)
+		var v Block
+		// The lengths are rejected before anything is allocated or read.
+		if err := v.Read(&io.LimitedReader{R: &body, N: test.limit}); err == nil || !strings.Contains(err.Error(), "too many") {
+			t.Errorf("%v: wrong error: %v", test.name, err)
+		}
+	}
+}
+
+// testBlockHeader returns a block header with every field set.
+func testBlockHeader() BlockHeader {
+	h := BlockHeader{
+		Version:         1,
+		Height:          2,
+		Previous:        Hash{1},
+		Timestamp:       time.Unix(1527000000, 0),
+		TotalDifficulty: 3,
+		OutputRoot:      Hash{4},
+		RangeProofRoot:  Hash{5},
+		KernelRoot:      Hash{6},
+		Nonce:           7,
+	}
+	h.TotalKernelOffset[0] = 8
+	h.ProofOfWork.Nonces = make([]uint32, ProofSize)
+	for i := range h.ProofOfWork.Nonces {
+		h.ProofOfWork.Nonces[i] = uint32(i * 1000)
+	}
+	return h
+}
+
+// testBlock returns a block with every field set.
+func testBlock() Block {
+	return Block{
+		Header:  testBlockHeader(),
+		Inputs:  []Input{testInput(), testInput()},
+		Outputs: []Output{testOutput()},
+		Kernels: []TxKernel{testTxKernel()},
+	}
+}
+
+func TestBlockHeaderRoundTrip(t *testing.T) {
+	v := testBlockHeader()
+	var b bytes.Buffer
+	if err := v.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != blockHeaderLen {
+		t.Errorf("wrong block header length: expecting %v, got %v", blockHeaderLen, b.Len())
+	}
+	var got BlockHeader
+	if err := got.Read(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("wrong block header: expecting %v, got %v", v, got)
+	}
+}
+
+func TestProofRoundTrip(t *testing.T) {
+	v := testBlockHeader().ProofOfWork
+	var b bytes.Buffer
+	if err := v.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	var got Proof
+	if err := got.Read(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("wrong proof: expecting %v, got %v", v, got)
+	}
+	if err := (Proof{}).Write(&b); err == nil {
+		t.Error("did not return error on proof without nonces")
+	}
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	for _, m := range []Message{
+		&Block{Header: testBlockHeader(), Inputs: []Input{}, Outputs: []Output{}, Kernels: []TxKernel{}},
+		func() Message { v := testBlock(); return &v }(),
+		func() Message { v := testBlockHeader(); return &v }(),
+		&BlockHeaders{Headers: []BlockHeader{testBlockHeader(), testBlockHeader()}},
+	} {
+		var b bytes.Buffer
+		if err := WriteMessage(&b, m); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadMessage(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("wrong message of type %v: expecting %v, got %v", m.Type(), m, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package message
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Capabilities represents the capabilities of the client.
+type Capabilities uint32
+
+const (
+	// UnknownCapabilities represents capabilities that are unknown.
+	UnknownCapabilities Capabilities = 0
+	// HeaderHistCapabilities is set by nodes that can serve the full history of block headers.
+	HeaderHistCapabilities Capabilities = 1 << 0
+	// TxHashSetHistCapabilities is set by nodes that can serve the full TxHashSet history.
+	TxHashSetHistCapabilities Capabilities = 1 << 1
+	// PeerListCapabilities is set by nodes that can serve lists of peer addresses.
+	PeerListCapabilities Capabilities = 1 << 2
+	// TxKernelHashCapabilities is set by nodes that can relay transaction kernel hashes.
+	TxKernelHashCapabilities Capabilities = 1 << 3
+	// FullNodeCapabilities are all the capabilities of a full node.
+	FullNodeCapabilities = HeaderHistCapabilities | TxHashSetHistCapabilities | PeerListCapabilities | TxKernelHashCapabilities
+)
+
+// capabilityNames are the names of the capabilities, as used by Grin.
+var capabilityNames = []struct {
+	c    Capabilities
+	name string
+}{
+	{HeaderHistCapabilities, "HEADER_HIST"},
+	{TxHashSetHistCapabilities, "TXHASHSET_HIST"},
+	{PeerListCapabilities, "PEER_LIST"},
+	{TxKernelHashCapabilities, "TX_KERNEL_HASH"},
+}
+
+// Has returns true if all the capabilities in o are set.
+func (c Capabilities) Has(o Capabilities) bool {
+	return c&o == o
+}
+
+// String returns the names of the capabilities separated by "|".
+// Unnamed bits are written as a hex number.
+func (c Capabilities) String() string {
+	if c == UnknownCapabilities {
+		return "UNKNOWN"
+	}
+	var names []string
+	rest := c
+	for _, n := range capabilityNames {
+		if c.Has(n.c) {
+			names = append(names, n.name)
+			rest &^= n.c
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(rest)))
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseCapabilities parses capabilities written by String.
+// Names may also be separated by commas, and "FULL_NODE" stands for FullNodeCapabilities.
+func ParseCapabilities(s string) (Capabilities, error) {
+	var c Capabilities
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ',' }) {
+		f = strings.ToUpper(strings.TrimSpace(f))
+		switch f {
+		case "", "UNKNOWN":
+			continue
+		case "FULL_NODE":
+			c |= FullNodeCapabilities
+			continue
+		}
+		found := false
+		for _, n := range capabilityNames {
+			if n.name == f {
+				c |= n.c
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		v, err := strconv.ParseUint(f, 0, 32)
+		if err != nil {
+			return UnknownCapabilities, fmt.Errorf("unknown capability %q", f)
+		}
+		c |= Capabilities(v)
+	}
+	return c, nil
+}
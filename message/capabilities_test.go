@@ -0,0 +1,47 @@
+package message
+
+import "testing"
+
+func TestCapabilitiesString(t *testing.T) {
+	tests := []struct {
+		c Capabilities
+		s string
+	}{
+		{UnknownCapabilities, "UNKNOWN"},
+		{PeerListCapabilities, "PEER_LIST"},
+		{HeaderHistCapabilities | TxKernelHashCapabilities, "HEADER_HIST|TX_KERNEL_HASH"},
+		{FullNodeCapabilities, "HEADER_HIST|TXHASHSET_HIST|PEER_LIST|TX_KERNEL_HASH"},
+		{PeerListCapabilities | 1<<8, "PEER_LIST|0x100"},
+	}
+	for _, test := range tests {
+		if s := test.c.String(); s != test.s {
+			t.Errorf("wrong string for %d: expecting %v, got %v", uint32(test.c), test.s, s)
+		}
+		c, err := ParseCapabilities(test.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != test.c {
+			t.Errorf("wrong capabilities for %v: expecting %v, got %v", test.s, test.c, c)
+		}
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	c, err := ParseCapabilities("peer_list, full_node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != FullNodeCapabilities {
+		t.Errorf("wrong capabilities: expecting %v, got %v", FullNodeCapabilities, c)
+	}
+	if _, err := ParseCapabilities("FLY"); err == nil {
+		t.Error("did not return error on unknown capability")
+	}
+	if !FullNodeCapabilities.Has(PeerListCapabilities | HeaderHistCapabilities) {
+		t.Error("full node does not have peer list and header history")
+	}
+	if PeerListCapabilities.Has(FullNodeCapabilities) {
+		t.Error("peer list has all capabilities")
+	}
+}
@@ -1,88 +1,160 @@
 package message
 
 import (
-	"bytes"
+	"crypto/rand"
 	"encoding/binary"
+	"fmt"
+	"io"
 )
 
-// NewHand returns a new handshake.
-func NewHand() (bytes.Buffer, error) {
-	var b bytes.Buffer
+func init() {
+	Register(MsgTypeHand, func() Message { return new(Hand) })
+}
+
+// Hand is the first part of the handshake.
+type Hand struct {
+	// Version is the version of the network on which is the sender.
+	Version ProtocolVersion
+	// Capabilities represents client capabilities of the sender.
+	Capabilities Capabilities
+	// Nonce is a random number used to detect connections to self.
+	Nonce uint64
+	// Total difficulty is the current total difficulty according to the sender.
+	TotalDifficulty uint64
+	// SenderAddr is the address of the sender.
+	SenderAddr SockAddr
+	// ReceiverAddr is the address of the receiver.
+	ReceiverAddr SockAddr
+	// UserAgent is the user agent of the sender.
+	UserAgent string
+	// Hash is the hash of the genesis.
+	Hash Hash
+}
+
+// NewHand returns a new hand from the sender to the receiver with a random nonce.
+// The total difficulty is the one of the local chain and genesis is the hash of its genesis block.
+func NewHand(sender, receiver SockAddr, totalDifficulty uint64, genesis Hash) (*Hand, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	return &Hand{
+		Version:         ProtocolVersion1,
+		Capabilities:    UnknownCapabilities,
+		Nonce:           nonce,
+		TotalDifficulty: totalDifficulty,
+		SenderAddr:      sender,
+		ReceiverAddr:    receiver,
+		UserAgent:       userAgent,
+		Hash:            genesis,
+	}, nil
+}
+
+// NewNonce returns a random nonce.
+func NewNonce() (uint64, error) {
+	var nonce uint64
+	if err := binary.Read(rand.Reader, binary.BigEndian, &nonce); err != nil {
+		return 0, fmt.Errorf("could not generate nonce: %v", err)
+	}
+	return nonce, nil
+}
+
+// Type returns the hand message type.
+func (v *Hand) Type() MsgType {
+	return MsgTypeHand
+}
+
+// Read populates the hand with values from the reader.
+func (v *Hand) Read(r io.Reader) error {
 	// Protocol version (u32).
-	if err := binary.Write(&b, binary.BigEndian, ProtocolVersion1); err != nil {
-		return bytes.Buffer{}, err
+	if err := binary.Read(r, binary.BigEndian, &v.Version); err != nil {
+		return fmt.Errorf("could not read version: %v", err)
 	}
 	// Capabilities (u32).
-	if err := binary.Write(&b, binary.BigEndian, uint32(0)); err != nil {
-		return bytes.Buffer{}, err
+	if err := binary.Read(r, binary.BigEndian, &v.Capabilities); err != nil {
+		return fmt.Errorf("could not read capabilities: %v", err)
 	}
 	// Nonce (u64).
-	if err := binary.Write(&b, binary.BigEndian, uint64(1)); err != nil {
-		return bytes.Buffer{}, err
+	if err := binary.Read(r, binary.BigEndian, &v.Nonce); err != nil {
+		return fmt.Errorf("could not read nonce: %v", err)
 	}
 	// Total difficulty (u64).
-	if err := binary.Write(&b, binary.BigEndian, uint64(1)); err != nil {
-		return bytes.Buffer{}, err
+	if err := binary.Read(r, binary.BigEndian, &v.TotalDifficulty); err != nil {
+		return fmt.Errorf("could not read total difficulty: %v", err)
 	}
 	// Sender address.
-	// Leading zero because this is IP v4.
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	if err := v.SenderAddr.Read(r); err != nil {
+		return fmt.Errorf("could not read sender address: %v", err)
 	}
-	// Sender IP v4 in the next 4 parts.
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
-
+	// Receiver address.
+	if err := v.ReceiverAddr.Read(r); err != nil {
+		return fmt.Errorf("could not read receiver address: %v", err)
 	}
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	// User agent length.
+	var len uint64
+	if err := binary.Read(r, binary.BigEndian, &len); err != nil {
+		return fmt.Errorf("could not read user agent length: %v", err)
 	}
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	if len > MaxMsgLen(MsgTypeHand) {
+		return fmt.Errorf("user agent too long: %v", len)
 	}
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	// User agent.
+	agent := make([]byte, len)
+	if _, err := io.ReadFull(r, agent); err != nil {
+		return fmt.Errorf("could not read user agent: %v", err)
 	}
-	// Sender port.
-	if err := binary.Write(&b, binary.BigEndian, uint16(13414)); err != nil {
-		return bytes.Buffer{}, err
+	v.UserAgent = string(agent)
+	// Genesis hash.
+	if err := binary.Read(r, binary.BigEndian, &v.Hash); err != nil {
+		return fmt.Errorf("could not read genesis hash: %v", err)
 	}
-	// Receiver address.
-	// Leading zero because this is IP v4.
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	return nil
+}
+
+// Write writes the hand values to the writer.
+func (v *Hand) Write(w io.Writer) error {
+	// Protocol version (u32).
+	if err := binary.Write(w, binary.BigEndian, v.Version); err != nil {
+		return fmt.Errorf("could not write version: %v", err)
 	}
-	// IP v4 in the next 4 parts.
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	// Capabilities (u32).
+	if err := binary.Write(w, binary.BigEndian, v.Capabilities); err != nil {
+		return fmt.Errorf("could not write capabilities: %v", err)
 	}
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	// Nonce (u64).
+	if err := binary.Write(w, binary.BigEndian, v.Nonce); err != nil {
+		return fmt.Errorf("could not write nonce: %v", err)
 	}
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	// Total difficulty (u64).
+	if err := binary.Write(w, binary.BigEndian, v.TotalDifficulty); err != nil {
+		return fmt.Errorf("could not write total difficulty: %v", err)
 	}
-	if err := binary.Write(&b, binary.BigEndian, uint8(0)); err != nil {
-		return bytes.Buffer{}, err
+	// Sender address.
+	if err := v.SenderAddr.Write(w); err != nil {
+		return fmt.Errorf("could not write sender address: %v", err)
 	}
-	// Receiver port.
-	if err := binary.Write(&b, binary.BigEndian, uint16(13414)); err != nil {
-		return bytes.Buffer{}, err
+	// Receiver address.
+	if err := v.ReceiverAddr.Write(w); err != nil {
+		return fmt.Errorf("could not write receiver address: %v", err)
 	}
 	// User agent.
 	// First we need to send the length.
-	ua := []byte(userAgent)
-	if err := binary.Write(&b, binary.BigEndian, uint64(len(ua))); err != nil {
-		return bytes.Buffer{}, err
+	ua := []byte(v.UserAgent)
+	if err := binary.Write(w, binary.BigEndian, uint64(len(ua))); err != nil {
+		return fmt.Errorf("could not write user agent length: %v", err)
 	}
 	// Now send the user agent.
-	if err := binary.Write(&b, binary.BigEndian, ua); err != nil {
-		return bytes.Buffer{}, err
+	if _, err := w.Write(ua); err != nil {
+		return fmt.Errorf("could not write user agent: %v", err)
 	}
-	// Genesis hash for test network 2.
-	gen := [32]uint8{51, 70, 246, 60, 245, 178, 94, 20, 173, 221, 136, 85, 226, 117, 87, 132, 229, 94, 97, 44, 213, 133, 97, 200, 202, 24, 215, 207, 108, 168, 111, 75}
-	if err := binary.Write(&b, binary.BigEndian, gen); err != nil {
-		return bytes.Buffer{}, err
+	// Genesis hash.
+	if err := binary.Write(w, binary.BigEndian, v.Hash); err != nil {
+		return fmt.Errorf("could not write genesis hash: %v", err)
 	}
-	return b, nil
+	return nil
+}
+
+// Len returns the length of the hand body.
+func (v *Hand) Len() uint64 {
+	return encodedLen(v.Write)
 }
@@ -1,12 +1,85 @@
 package message
 
-type Hash [32]uint8
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashSize is the size of a hash.
+const HashSize = 32
+
+// Hash is a Blake2b-256 hash.
+type Hash [HashSize]uint8
+
+// ZeroHash returns the hash with all bytes set to zero.
 func ZeroHash() Hash {
 	var h [32]uint8
 	return h
 }
 
-func GenesisHash() Hash {
-	return [32]uint8{51, 70, 246, 60, 245, 178, 94, 20, 173, 221, 136, 85, 226, 117, 87, 132, 229, 94, 97, 44, 213, 133, 97, 200, 202, 24, 215, 207, 108, 168, 111, 75}
+// ParseHash parses a hex encoded hash.
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return h, fmt.Errorf("could not decode hash: %v", err)
+	}
+	if len(b) != HashSize {
+		return h, fmt.Errorf("wrong hash length: expecting %v, got %v", HashSize, len(b))
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// String returns the hash encoded as hex.
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// IsZero returns true if the hash is the zero hash.
+func (h Hash) IsZero() bool {
+	return h == ZeroHash()
+}
+
+// MarshalText encodes the hash as hex.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes the hash from hex.
+func (h *Hash) UnmarshalText(text []byte) error {
+	v, err := ParseHash(string(text))
+	if err != nil {
+		return err
+	}
+	*h = v
+	return nil
+}
+
+// MarshalJSON encodes the hash as a hex string.
+func (h Hash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+// UnmarshalJSON decodes the hash from a hex string.
+func (h *Hash) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("could not decode hash: %v", err)
+	}
+	return h.UnmarshalText([]byte(s))
+}
+
+// hashOf returns the Blake2b-256 hash of the bytes written by the write function.
+func hashOf(write func(w io.Writer) error) Hash {
+	d, _ := blake2b.New256(nil)
+	// Writing to the digest never fails.
+	write(d)
+	var h Hash
+	copy(h[:], d.Sum(nil))
+	return h
 }
@@ -0,0 +1,71 @@
+package message
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestParseHash(t *testing.T) {
+	s := "3346f63cf5b25e14addd8855e2755784e55e612cd58561c8ca18d7cf6ca86f4b"
+	h, err := ParseHash(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != GenesisHash() {
+		t.Errorf("wrong hash: expecting %v, got %v", GenesisHash(), h)
+	}
+	if h.String() != s {
+		t.Errorf("wrong string: expecting %v, got %v", s, h.String())
+	}
+	for _, bad := range []string{"", "zz", s[2:], s + "00"} {
+		if _, err := ParseHash(bad); err == nil {
+			t.Errorf("did not return error on bad hash %q", bad)
+		}
+	}
+}
+
+func TestHashJSON(t *testing.T) {
+	v := struct{ Hash Hash }{GenesisHash()}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Hash":"3346f63cf5b25e14addd8855e2755784e55e612cd58561c8ca18d7cf6ca86f4b"}`
+	if string(b) != want {
+		t.Errorf("wrong json: expecting %s, got %s", want, b)
+	}
+	v.Hash = ZeroHash()
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Hash != GenesisHash() {
+		t.Errorf("wrong hash: expecting %v, got %v", GenesisHash(), v.Hash)
+	}
+}
+
+func TestBlockHeaderHash(t *testing.T) {
+	h := testBlockHeader()
+	// Empty input hashed with Blake2b-256.
+	if got := hashOf(func(w io.Writer) error { return nil }).String(); got != "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8" {
+		t.Errorf("wrong hash of empty input: %v", got)
+	}
+	if h.Hash() == h.PrePoWHash() {
+		t.Error("hash and pre pow hash are the same")
+	}
+	// The proof of work is for the nonce but not for the proof itself.
+	other := h
+	other.Nonce++
+	if other.Hash() == h.Hash() || other.PrePoWHash() == h.PrePoWHash() {
+		t.Error("hash or pre pow hash did not change with nonce")
+	}
+	other = h
+	other.ProofOfWork = Proof{Nonces: append([]uint32{1}, h.ProofOfWork.Nonces[1:]...)}
+	if other.PrePoWHash() != h.PrePoWHash() || other.Hash() == h.Hash() {
+		t.Error("pre pow hash changed or hash did not change with proof")
+	}
+	b := Block{Header: h}
+	if b.Hash() != h.Hash() {
+		t.Error("block hash is not the header hash")
+	}
+}
@@ -3,20 +3,23 @@ package message
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 )
 
+var (
+	// ErrBadMagic is returned when a header does not start with the magic bytes.
+	ErrBadMagic = errors.New("bad magic bytes")
+	// ErrUnknownMsgType is returned when a header has an unknown message type.
+	ErrUnknownMsgType = errors.New("unknown message type")
+	// ErrMsgTooLarge is returned when a header announces a body larger than allowed for its type.
+	ErrMsgTooLarge = errors.New("message too large")
+)
+
 // HeaderLen is the expected length of the header.
 const HeaderLen int = 11
 
-const (
-	// Magic1 is the first magic byte.
-	Magic1 uint8 = 0x1e
-	// Magic2 is the second magic byte.
-	Magic2 uint8 = 0xc5
-)
-
 // Header is the message header.
 type Header struct {
 	// Magic1 is the first magic byte.
@@ -30,34 +33,50 @@ type Header struct {
 }
 
 // Read populates the header with the contents from the reader.
+// The header is validated once read.
 func (h *Header) Read(r io.Reader) error {
 	// Magic 1.
 	if err := binary.Read(r, binary.BigEndian, &h.Magic1); err != nil {
-		return fmt.Errorf("could not read first magic byte: %v", err)
+		return fmt.Errorf("could not read first magic byte: %w", err)
 	}
 	// Magic 2.
 	if err := binary.Read(r, binary.BigEndian, &h.Magic2); err != nil {
-		return fmt.Errorf("could not read second magic byte: %v", err)
+		return fmt.Errorf("could not read second magic byte: %w", err)
 	}
 	// Message type.
 	if err := binary.Read(r, binary.BigEndian, &h.MsgType); err != nil {
-		return fmt.Errorf("could not read message type: %v", err)
+		return fmt.Errorf("could not read message type: %w", err)
 	}
 	// Message length.
 	if err := binary.Read(r, binary.BigEndian, &h.Length); err != nil {
-		return fmt.Errorf("could not read message body length: %v", err)
+		return fmt.Errorf("could not read message body length: %w", err)
+	}
+	return h.Validate()
+}
+
+// Validate checks the magic bytes, the message type and the body length.
+func (h *Header) Validate() error {
+	if magic1, magic2 := Magic(); h.Magic1 != magic1 || h.Magic2 != magic2 {
+		return fmt.Errorf("%w: %#x %#x", ErrBadMagic, h.Magic1, h.Magic2)
+	}
+	if int(h.MsgType) >= len(maxMsgLen) {
+		return fmt.Errorf("%w: %v", ErrUnknownMsgType, h.MsgType)
+	}
+	if max := MaxMsgLen(h.MsgType); h.Length > max {
+		return fmt.Errorf("%w: %v bytes for message type %v, expecting at most %v", ErrMsgTooLarge, h.Length, h.MsgType, max)
 	}
 	return nil
 }
 
 // Write writes the header values to the writer.
 func (h *Header) Write(msgType MsgType, msgLen uint64, w io.Writer) error {
+	magic1, magic2 := Magic()
 	// Magic 1.
-	if err := binary.Write(w, binary.BigEndian, Magic1); err != nil {
+	if err := binary.Write(w, binary.BigEndian, magic1); err != nil {
 		return fmt.Errorf("could not write first magic byte: %v", err)
 	}
 	// Magic 2.
-	if err := binary.Write(w, binary.BigEndian, Magic2); err != nil {
+	if err := binary.Write(w, binary.BigEndian, magic2); err != nil {
 		return fmt.Errorf("could not write second magic byte: %v", err)
 	}
 	// Type of message.
@@ -74,12 +93,13 @@ func (h *Header) Write(msgType MsgType, msgLen uint64, w io.Writer) error {
 // NewHeader returns new header.
 func NewHeader(msgType MsgType, msgLen uint64) (bytes.Buffer, error) {
 	var b bytes.Buffer
+	magic1, magic2 := Magic()
 	// Magic 1.
-	if err := binary.Write(&b, binary.BigEndian, Magic1); err != nil {
+	if err := binary.Write(&b, binary.BigEndian, magic1); err != nil {
 		return bytes.Buffer{}, err
 	}
 	// Magic 2.
-	if err := binary.Write(&b, binary.BigEndian, Magic2); err != nil {
+	if err := binary.Write(&b, binary.BigEndian, magic2); err != nil {
 		return bytes.Buffer{}, err
 	}
 	// Type of message.
@@ -2,6 +2,7 @@ package message
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -46,13 +47,14 @@ func TestReadGoodHeader(t *testing.T) {
 	if err := h.Read(bytes.NewReader(b.Bytes())); err != nil {
 		t.Error(err)
 	}
+	magic1, magic2 := Magic()
 	// Magic 1.
-	if h.Magic1 != Magic1 {
-		t.Errorf("wrong first magic byte: expecting %v, got %v", Magic1, h.Magic1)
+	if h.Magic1 != magic1 {
+		t.Errorf("wrong first magic byte: expecting %v, got %v", magic1, h.Magic1)
 	}
 	// Magic 2.
-	if h.Magic2 != Magic2 {
-		t.Errorf("wrong second magic byte: expecting %v, got %v", Magic2, h.Magic2)
+	if h.Magic2 != magic2 {
+		t.Errorf("wrong second magic byte: expecting %v, got %v", magic2, h.Magic2)
 	}
 	// Message type.
 	if h.MsgType != msgType {
@@ -63,3 +65,23 @@ func TestReadGoodHeader(t *testing.T) {
 		t.Errorf("wrong message length: expecting %v, got %v", msgLen, h.Length)
 	}
 }
+
+func TestValidateHeader(t *testing.T) {
+	magic1, magic2 := Magic()
+	tests := []struct {
+		h   Header
+		err error
+	}{
+		{Header{magic1, magic2, MsgTypePing, 16}, nil},
+		{Header{magic1, 0, MsgTypePing, 16}, ErrBadMagic},
+		{Header{0, magic2, MsgTypePing, 16}, ErrBadMagic},
+		{Header{magic1, magic2, MsgTypeTxHashSetArchive + 1, 0}, ErrUnknownMsgType},
+		{Header{magic1, magic2, MsgTypePing, 17}, ErrMsgTooLarge},
+		{Header{magic1, magic2, MsgTypeBlock, 1 << 63}, ErrMsgTooLarge},
+	}
+	for _, test := range tests {
+		if err := test.h.Validate(); !errors.Is(err, test.err) {
+			t.Errorf("wrong error for header %v: expecting %v, got %v", test.h, test.err, err)
+		}
+	}
+}
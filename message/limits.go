@@ -0,0 +1,52 @@
+package message
+
+const (
+	// MaxPeerAddrs is the maximum number of addresses in a peer addresses message.
+	MaxPeerAddrs = 256
+	// MaxLocators is the maximum number of hashes in a locator.
+	MaxLocators = 20
+	// MaxBlockHeaders is the maximum number of headers in a block headers message.
+	MaxBlockHeaders = 512
+	// MaxBlockLen is the maximum length of a block message body.
+	MaxBlockLen = 20000000
+	// MaxTransactionLen is the maximum length of a transaction message body.
+	MaxTransactionLen = 1000000
+)
+
+// blockHeaderLen is the length of an encoded block header.
+const blockHeaderLen = 2 + 8 + 32 + 8 + 8 + 32 + 32 + 32 + 32 + 8 + 4*ProofSize
+
+// sockAddrMaxLen is the length of the largest encoded address (IPv6).
+const sockAddrMaxLen = 1 + 16 + 2
+
+// maxMsgLen is the maximum message body length indexed by message type.
+// The limits follow the ones enforced by Grin.
+var maxMsgLen = [...]uint64{
+	MsgTypeError:            0,
+	MsgTypeHand:             128,
+	MsgTypeShake:            88,
+	MsgTypePing:             16,
+	MsgTypePong:             16,
+	MsgTypeGetPeerAddrs:     4,
+	MsgTypePeerAddrs:        4 + sockAddrMaxLen*MaxPeerAddrs,
+	MsgTypeGetHeaders:       1 + 32*MaxLocators,
+	MsgTypeHeader:           blockHeaderLen,
+	MsgTypeHeaders:          2 + blockHeaderLen*MaxBlockHeaders,
+	MsgTypeGetBlock:         32,
+	MsgTypeBlock:            MaxBlockLen,
+	MsgTypeGetCompactBlock:  32,
+	MsgTypeCompactBlock:     MaxBlockLen / 10,
+	MsgTypeStemTransaction:  MaxTransactionLen,
+	MsgTypeTransaction:      MaxTransactionLen,
+	MsgTypeTxHashSetRequest: 40,
+	MsgTypeTxHashSetArchive: 64,
+}
+
+// MaxMsgLen returns the maximum body length for the message type.
+// It returns zero for unknown message types.
+func MaxMsgLen(t MsgType) uint64 {
+	if int(t) >= len(maxMsgLen) {
+		return 0
+	}
+	return maxMsgLen[t]
+}
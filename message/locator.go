@@ -4,36 +4,94 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-
-	"github.com/golang/glog"
 )
 
+// Locator is a list of block hashes used to find the common ancestor with a peer.
 type Locator struct {
 	Hashes []Hash
 }
 
-func (v Locator) Write(w io.Writer) error {
-	glog.Info("writing length")
-	len := len(v.Hashes)
-	if len == 0 {
-		// Write genesis hash.
-		if err := binary.Write(w, binary.BigEndian, uint8(1)); err != nil {
-			return fmt.Errorf("could not write length: %v", err)
+// NewLocator returns a locator for the chain with the tip at the height.
+// The hashes are picked at exponentially increasing distances from the tip down to the genesis.
+// hashAt returns the hash of the block at the height on the local chain.
+func NewLocator(height uint64, hashAt func(height uint64) (Hash, error)) (Locator, error) {
+	heights := LocatorHeights(height)
+	v := Locator{Hashes: make([]Hash, len(heights))}
+	for i, h := range heights {
+		hash, err := hashAt(h)
+		if err != nil {
+			return Locator{}, fmt.Errorf("could not get hash at height %v: %v", h, err)
+		}
+		v.Hashes[i] = hash
+	}
+	return v, nil
+}
+
+// LocatorHeights returns the heights of the blocks to include in a locator for the chain with the tip at the height.
+// The heights start at the tip and always end with the genesis at height zero.
+func LocatorHeights(height uint64) []uint64 {
+	var heights []uint64
+	for current := height; current > 0; {
+		heights = append(heights, current)
+		if len(heights) >= MaxLocators-1 {
+			break
 		}
-		glog.Info("writing genesis hash")
-		if err := binary.Write(w, binary.BigEndian, GenesisHash()); err != nil {
-			return fmt.Errorf("could not write genesis hash: %v", err)
+		next := uint64(1) << uint(len(heights))
+		if current > next {
+			current -= next
+		} else {
+			current = 0
 		}
-		return nil
 	}
-	for i := 0; i < len; i++ {
-		// Write more than one hash.
-		if err := binary.Write(w, binary.BigEndian, uint8(len)); err != nil {
-			return fmt.Errorf("could not write length: %v", err)
+	return append(heights, 0)
+}
+
+// Read reads the locator.
+func (v *Locator) Read(r io.Reader) error {
+	var len uint8
+	if err := binary.Read(r, binary.BigEndian, &len); err != nil {
+		return fmt.Errorf("could not read length: %v", err)
+	}
+	if len > MaxLocators {
+		return fmt.Errorf("too many hashes: %v", len)
+	}
+	v.Hashes = make([]Hash, len)
+	for i := range v.Hashes {
+		if err := binary.Read(r, binary.BigEndian, &v.Hashes[i]); err != nil {
+			return fmt.Errorf("could not read hash: %v", err)
 		}
-		if err := binary.Write(w, binary.BigEndian, v.Hashes[i]); err != nil {
+	}
+	return nil
+}
+
+// Write writes the locator.
+// An empty locator is written as the genesis hash alone.
+func (v Locator) Write(w io.Writer) error {
+	hashes := v.Hashes
+	if len(hashes) == 0 {
+		hashes = []Hash{GenesisHash()}
+	}
+	if len(hashes) > MaxLocators {
+		return fmt.Errorf("too many hashes: %v", len(hashes))
+	}
+	// Length.
+	if err := binary.Write(w, binary.BigEndian, uint8(len(hashes))); err != nil {
+		return fmt.Errorf("could not write length: %v", err)
+	}
+	// Hashes.
+	for _, h := range hashes {
+		if err := binary.Write(w, binary.BigEndian, h); err != nil {
 			return fmt.Errorf("could not write hash: %v", err)
 		}
 	}
 	return nil
 }
+
+// Len returns the length of the encoded locator.
+func (v Locator) Len() uint64 {
+	n := len(v.Hashes)
+	if n == 0 {
+		n = 1
+	}
+	return 1 + HashSize*uint64(n)
+}
@@ -0,0 +1,77 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLocatorHeights(t *testing.T) {
+	tests := []struct {
+		height uint64
+		want   []uint64
+	}{
+		{0, []uint64{0}},
+		{1, []uint64{1, 0}},
+		{2, []uint64{2, 0}},
+		{10, []uint64{10, 8, 4, 0}},
+		{1000, []uint64{1000, 998, 994, 986, 970, 938, 874, 746, 490, 0}},
+	}
+	for _, test := range tests {
+		if got := LocatorHeights(test.height); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrong heights for %v: expecting %v, got %v", test.height, test.want, got)
+		}
+	}
+	if got := LocatorHeights(1 << 40); len(got) != MaxLocators {
+		t.Errorf("wrong number of heights: expecting %v, got %v", MaxLocators, len(got))
+	}
+}
+
+func TestNewLocator(t *testing.T) {
+	hashAt := func(height uint64) (Hash, error) {
+		var h Hash
+		binary.BigEndian.PutUint64(h[:], height)
+		return h, nil
+	}
+	l, err := NewLocator(10, hashAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := GetHeaders{Locator: l}
+	var b bytes.Buffer
+	if err := WriteMessage(&b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != HeaderLen+1+4*HashSize {
+		t.Errorf("wrong message length: %v", b.Len())
+	}
+	got, err := ReadMessage(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.(*GetHeaders).Locator, l) {
+		t.Errorf("wrong locator: expecting %v, got %v", l, got.(*GetHeaders).Locator)
+	}
+	if _, err := NewLocator(10, func(uint64) (Hash, error) { return Hash{}, fmt.Errorf("missing") }); err == nil {
+		t.Error("did not return error on missing hash")
+	}
+}
+
+func TestEmptyLocator(t *testing.T) {
+	var b bytes.Buffer
+	var l Locator
+	if err := l.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if uint64(b.Len()) != l.Len() {
+		t.Errorf("wrong length: expecting %v, got %v", l.Len(), b.Len())
+	}
+	if err := l.Read(&b); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Hashes) != 1 || l.Hashes[0] != GenesisHash() {
+		t.Errorf("expecting genesis hash, got %v", l.Hashes)
+	}
+}
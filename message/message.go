@@ -54,11 +54,3 @@ const (
 	// ProtocolVersion1 is the current network protocol version.
 	ProtocolVersion1 ProtocolVersion = 1
 )
-
-// Capabilities represents the capabilities of the client.
-type Capabilities uint32
-
-const (
-	// UnknownCapabilities represents capabilities that are unknown.
-	UnknownCapabilities Capabilities = 0 << 0
-)
@@ -0,0 +1,54 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNetworkInUse is returned when another network is already in use.
+var ErrNetworkInUse = errors.New("another network is in use")
+
+// network is the network in use. It is set once, by UseNetwork or on first use,
+// and never changes after, so that it can be read without locking.
+var network struct {
+	once   sync.Once
+	magic1 uint8
+	magic2 uint8
+	// genesis is the hash of the genesis block.
+	genesis Hash
+}
+
+// testnet2 sets test network 2, the default network.
+func testnet2() {
+	network.magic1 = 0x1e
+	network.magic2 = 0xc5
+	network.genesis = Hash{51, 70, 246, 60, 245, 178, 94, 20, 173, 221, 136, 85, 226, 117, 87, 132, 229, 94, 97, 44, 213, 133, 97, 200, 202, 24, 215, 207, 108, 168, 111, 75}
+}
+
+// UseNetwork sets the magic bytes and the genesis hash of the network in use.
+// It must be called before any message is read or written, otherwise test network 2 is in use.
+// The network cannot be changed once set.
+func UseNetwork(magic1, magic2 uint8, genesis Hash) error {
+	network.once.Do(func() {
+		network.magic1 = magic1
+		network.magic2 = magic2
+		network.genesis = genesis
+	})
+	if network.magic1 != magic1 || network.magic2 != magic2 || network.genesis != genesis {
+		return fmt.Errorf("%w: magic bytes %#x %#x, genesis %v", ErrNetworkInUse, network.magic1, network.magic2, network.genesis)
+	}
+	return nil
+}
+
+// Magic returns the magic bytes of the network in use.
+func Magic() (uint8, uint8) {
+	network.once.Do(testnet2)
+	return network.magic1, network.magic2
+}
+
+// GenesisHash returns the hash of the genesis block of the network in use.
+func GenesisHash() Hash {
+	network.once.Do(testnet2)
+	return network.genesis
+}
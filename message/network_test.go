@@ -0,0 +1,21 @@
+package message
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUseNetwork(t *testing.T) {
+	// Test network 2 is in use by default.
+	magic1, magic2 := Magic()
+	genesis := GenesisHash()
+	if err := UseNetwork(magic1, magic2, genesis); err != nil {
+		t.Fatal(err)
+	}
+	if err := UseNetwork(0x52, 0x54, genesis); !errors.Is(err, ErrNetworkInUse) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrNetworkInUse, err)
+	}
+	if m1, m2 := Magic(); m1 != magic1 || m2 != magic2 {
+		t.Errorf("network changed: magic bytes %#x %#x", m1, m2)
+	}
+}
@@ -8,32 +8,54 @@ import (
 	"github.com/golang/glog"
 )
 
+func init() {
+	Register(MsgTypeGetPeerAddrs, func() Message { return new(GetPeerAddrs) })
+	Register(MsgTypePeerAddrs, func() Message { return new(PeerAddrs) })
+}
+
 // GetPeerAddrs is a request for peer addresses.
 type GetPeerAddrs struct {
 	// Capabilities filters peers by peer capabilities.
 	Capabilities Capabilities
 }
 
+// Type returns the get peer addresses message type.
+func (v GetPeerAddrs) Type() MsgType {
+	return MsgTypeGetPeerAddrs
+}
+
+// Read reads request to get peer addresses.
+func (v *GetPeerAddrs) Read(r io.Reader) error {
+	if err := binary.Read(r, binary.BigEndian, &v.Capabilities); err != nil {
+		return fmt.Errorf("could not read capabilities: %v", err)
+	}
+	return nil
+}
+
 // Write writes request to get peer addresses.
 func (v GetPeerAddrs) Write(w io.Writer) error {
-	// Header.
-	var h Header
-	if err := h.Write(MsgTypeGetPeerAddrs, 4, w); err != nil {
-		return fmt.Errorf("could not write header for ping message: %v", err)
-	}
-	// Body
-	if err := binary.Write(w, binary.BigEndian, UnknownCapabilities); err != nil {
+	if err := binary.Write(w, binary.BigEndian, v.Capabilities); err != nil {
 		return fmt.Errorf("could not write capabilities: %v", err)
 	}
 	return nil
 }
 
+// Len returns the length of the request body.
+func (v GetPeerAddrs) Len() uint64 {
+	return 4
+}
+
 // PeerAddrs contains peer addresses.
 type PeerAddrs struct {
 	// Peers represents peers.
 	Peers []SockAddr
 }
 
+// Type returns the peer addresses message type.
+func (v PeerAddrs) Type() MsgType {
+	return MsgTypePeerAddrs
+}
+
 // Read reads peer addresses.
 func (v *PeerAddrs) Read(r io.Reader) error {
 	var len uint32
@@ -41,6 +63,9 @@ func (v *PeerAddrs) Read(r io.Reader) error {
 	if err := binary.Read(r, binary.BigEndian, &len); err != nil {
 		return err
 	}
+	if len > MaxPeerAddrs {
+		return fmt.Errorf("too many peers: %v", len)
+	}
 	glog.Infof("reading %v peers", len)
 	p := make([]SockAddr, len)
 	for i := uint32(0); i < len; i++ {
@@ -65,3 +90,8 @@ func (v PeerAddrs) Write(w io.Writer) error {
 	}
 	return nil
 }
+
+// Len returns the length of the encoded peer addresses.
+func (v PeerAddrs) Len() uint64 {
+	return encodedLen(v.Write)
+}
@@ -6,6 +6,14 @@ import (
 	"io"
 )
 
+func init() {
+	Register(MsgTypePing, func() Message { return new(Ping) })
+	Register(MsgTypePong, func() Message { return new(Pong) })
+}
+
+// pingLen is the length of the ping and pong message bodies.
+const pingLen = 16
+
 // Ping is the "ping" message.
 type Ping struct {
 	//  TotalDifficulty is the total difficulty accumulated by the user agent. It may be used to check whether sync may be needed.
@@ -14,6 +22,11 @@ type Ping struct {
 	Height uint64
 }
 
+// Type returns the ping message type.
+func (p *Ping) Type() MsgType {
+	return MsgTypePing
+}
+
 // Read populates the ping with values from the reader.
 func (p *Ping) Read(r io.Reader) error {
 	// Total difficult.
@@ -28,20 +41,7 @@ func (p *Ping) Read(r io.Reader) error {
 }
 
 // Write writes the ping values to the writer.
-// Set pong to true if message type should be set to "pong".
-func (p *Ping) Write(pong bool, w io.Writer) error {
-	// Send ping and pong are currently identical we can set the message type here.
-	var msgType MsgType
-	if pong {
-		msgType = MsgTypePong
-	} else {
-		msgType = MsgTypePing
-	}
-	// Header.
-	var h Header
-	if err := h.Write(msgType, 16, w); err != nil {
-		return fmt.Errorf("could not write header for ping message: %v", err)
-	}
+func (p *Ping) Write(w io.Writer) error {
 	// Total difficulty.
 	if err := binary.Write(w, binary.BigEndian, &p.TotalDifficulty); err != nil {
 		return fmt.Errorf("could not write total difficulty: %v", err)
@@ -52,3 +52,32 @@ func (p *Ping) Write(pong bool, w io.Writer) error {
 	}
 	return nil
 }
+
+// Len returns the length of the ping body.
+func (p *Ping) Len() uint64 {
+	return pingLen
+}
+
+// Pong is the "pong" message sent in reply to a ping.
+// It carries the same values as the ping.
+type Pong Ping
+
+// Type returns the pong message type.
+func (p *Pong) Type() MsgType {
+	return MsgTypePong
+}
+
+// Read populates the pong with values from the reader.
+func (p *Pong) Read(r io.Reader) error {
+	return (*Ping)(p).Read(r)
+}
+
+// Write writes the pong values to the writer.
+func (p *Pong) Write(w io.Writer) error {
+	return (*Ping)(p).Write(w)
+}
+
+// Len returns the length of the pong body.
+func (p *Pong) Len() uint64 {
+	return pingLen
+}
@@ -2,6 +2,7 @@ package message
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 )
 
@@ -24,3 +25,16 @@ func (v *Proof) Read(r io.Reader) error {
 	}
 	return nil
 }
+
+// Write writes the proof.
+func (v Proof) Write(w io.Writer) error {
+	if len(v.Nonces) != ProofSize {
+		return fmt.Errorf("invalid number of nonces: %v", len(v.Nonces))
+	}
+	return binary.Write(w, binary.BigEndian, v.Nonces)
+}
+
+// Hash returns the hash of the proof, from which its difficulty is derived.
+func (v Proof) Hash() Hash {
+	return hashOf(v.Write)
+}
@@ -0,0 +1,181 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+var (
+	// ErrBodyUnderrun is returned when a message decoder did not read the whole body.
+	ErrBodyUnderrun = errors.New("message body not fully consumed")
+	// ErrBodyOverrun is returned when a message decoder tried to read past the end of the body.
+	ErrBodyOverrun = errors.New("message body shorter than expected")
+)
+
+// BodyError is returned by ReadMessage when the body of a message could not be decoded.
+// The body has been consumed in full, so the next message can still be read from the stream.
+type BodyError struct {
+	// MsgType is the type of the message.
+	MsgType MsgType
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *BodyError) Error() string {
+	return fmt.Sprintf("could not read message body of type %v: %v", e.MsgType, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// Message is a message that can be sent to and received from a peer.
+type Message interface {
+	// Type returns the type of the message.
+	Type() MsgType
+	// Read populates the message with the body from the reader.
+	Read(r io.Reader) error
+	// Write writes the message body (without the header) to the writer.
+	Write(w io.Writer) error
+	// Len returns the length of the message body in bytes.
+	Len() uint64
+}
+
+var (
+	// registryMu guards registry.
+	registryMu sync.RWMutex
+	// registry maps message types to functions returning new empty messages.
+	registry = make(map[MsgType]func() Message)
+)
+
+// Register makes a message type decodable by ReadMessage.
+// It panics if the message type is already registered.
+func Register(t MsgType, f func() Message) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[t]; ok {
+		panic(fmt.Sprintf("message type %v registered twice", t))
+	}
+	registry[t] = f
+}
+
+// New returns a new empty message of the given type.
+// Types without a registered decoder are returned as Raw.
+func New(t MsgType) Message {
+	registryMu.RLock()
+	f, ok := registry[t]
+	registryMu.RUnlock()
+	if !ok {
+		return &Raw{MsgType: t}
+	}
+	return f()
+}
+
+// ReadMessage reads the header and the body of the next message from the reader.
+// The body is decoded from a reader limited to the length in the header.
+// If the body is malformed, the rest of it is discarded and a *BodyError is returned.
+// Any other error means that the stream can no longer be read.
+func ReadMessage(r io.Reader) (Message, error) {
+	var h Header
+	if err := h.Read(r); err != nil {
+		return nil, err
+	}
+	m := New(h.MsgType)
+	if v, ok := m.(*Raw); ok {
+		v.Body = make([]byte, h.Length)
+	}
+	body := &io.LimitedReader{R: r, N: int64(h.Length)}
+	err := m.Read(body)
+	switch {
+	case err != nil && body.N == 0:
+		// The decoder wanted more than the body holds.
+		err = fmt.Errorf("%w: %v", ErrBodyOverrun, err)
+	case err == nil && body.N > 0:
+		err = ErrBodyUnderrun
+	}
+	// Skip whatever the decoder left behind.
+	if _, derr := io.Copy(ioutil.Discard, body); derr != nil || body.N > 0 {
+		if derr == nil {
+			derr = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("could not discard rest of message body of type %v: %w", h.MsgType, derr)
+	}
+	if err != nil {
+		return nil, &BodyError{MsgType: h.MsgType, Err: err}
+	}
+	return m, nil
+}
+
+// WriteMessage writes the header and the body of the message to the writer.
+func WriteMessage(w io.Writer, m Message) error {
+	var b bytes.Buffer
+	var h Header
+	if err := h.Write(m.Type(), m.Len(), &b); err != nil {
+		return err
+	}
+	if err := m.Write(&b); err != nil {
+		return fmt.Errorf("could not write message body of type %v: %v", m.Type(), err)
+	}
+	if n := uint64(b.Len() - HeaderLen); n != m.Len() {
+		return fmt.Errorf("message of type %v wrote %v bytes but expected %v", m.Type(), n, m.Len())
+	}
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("could not write message: %w", err)
+	}
+	return nil
+}
+
+// Raw is a message of a type without a registered decoder.
+// The body is kept as is.
+type Raw struct {
+	// MsgType is the type of the message.
+	MsgType MsgType
+	// Body is the undecoded message body.
+	Body []byte
+}
+
+// Type returns the type of the message.
+func (v *Raw) Type() MsgType {
+	return v.MsgType
+}
+
+// Read reads len(Body) bytes from the reader into the body.
+func (v *Raw) Read(r io.Reader) error {
+	_, err := io.ReadFull(r, v.Body)
+	return err
+}
+
+// Write writes the body.
+func (v *Raw) Write(w io.Writer) error {
+	_, err := w.Write(v.Body)
+	return err
+}
+
+// Len returns the length of the body.
+func (v *Raw) Len() uint64 {
+	return uint64(len(v.Body))
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n uint64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += uint64(len(p))
+	return len(p), nil
+}
+
+// encodedLen returns the number of bytes written by the write function.
+func encodedLen(write func(w io.Writer) error) uint64 {
+	var c countWriter
+	if err := write(&c); err != nil {
+		return 0
+	}
+	return c.n
+}
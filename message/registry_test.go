@@ -0,0 +1,99 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteReadMessage(t *testing.T) {
+	msgs := []Message{
+		&Ping{TotalDifficulty: 10, Height: 2},
+		&Pong{TotalDifficulty: 10, Height: 2},
+		&GetBlock{Hash: GenesisHash()},
+		&Shake{Version: ProtocolVersion1, TotalDifficulty: 5, UserAgent: userAgent, Hash: GenesisHash()},
+		&Raw{MsgType: MsgTypeTransaction, Body: []byte{1, 2, 3}},
+	}
+	for _, m := range msgs {
+		var b bytes.Buffer
+		if err := WriteMessage(&b, m); err != nil {
+			t.Fatal(err)
+		}
+		if uint64(b.Len()) != uint64(HeaderLen)+m.Len() {
+			t.Errorf("wrong length for message type %v: expecting %v, got %v", m.Type(), uint64(HeaderLen)+m.Len(), b.Len())
+		}
+		got, err := ReadMessage(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("wrong message: expecting %v, got %v", m, got)
+		}
+	}
+}
+
+func TestNewUnregistered(t *testing.T) {
+	m := New(MsgTypeCompactBlock)
+	if _, ok := m.(*Raw); !ok {
+		t.Errorf("expecting raw message, got %T", m)
+	}
+	if m.Type() != MsgTypeCompactBlock {
+		t.Errorf("wrong message type: expecting %v, got %v", MsgTypeCompactBlock, m.Type())
+	}
+}
+
+func TestReadMessageBounded(t *testing.T) {
+	var b bytes.Buffer
+	// No peer addresses followed by a trailing byte.
+	h, _ := NewHeader(MsgTypePeerAddrs, 5)
+	b.Write(h.Bytes())
+	b.Write(make([]byte, 5))
+	// A ping that is too short.
+	h, _ = NewHeader(MsgTypePing, pingLen-1)
+	b.Write(h.Bytes())
+	b.Write(make([]byte, pingLen-1))
+	// A good ping.
+	if err := WriteMessage(&b, &Ping{Height: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []error{ErrBodyUnderrun, ErrBodyOverrun} {
+		_, err := ReadMessage(&b)
+		var bodyErr *BodyError
+		if !errors.As(err, &bodyErr) || !errors.Is(err, want) {
+			t.Errorf("wrong error: expecting %v, got %v", want, err)
+		}
+	}
+	m, err := ReadMessage(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := m.(*Ping); !ok || p.Height != 3 {
+		t.Errorf("wrong message after bad messages: %v", m)
+	}
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	h, _ := NewHeader(MsgTypePing, pingLen)
+	b := bytes.NewBuffer(h.Bytes())
+	b.Write(make([]byte, pingLen/2))
+	_, err := ReadMessage(b)
+	var bodyErr *BodyError
+	if err == nil || errors.As(err, &bodyErr) {
+		t.Errorf("expecting stream error, got %v", err)
+	}
+}
+
+func TestGetPeerAddrsCapabilities(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteMessage(&b, &GetPeerAddrs{Capabilities: FullNodeCapabilities}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadMessage(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.(*GetPeerAddrs).Capabilities; c != FullNodeCapabilities {
+		t.Errorf("wrong capabilities: expecting %v, got %v", FullNodeCapabilities, c)
+	}
+}
@@ -6,6 +6,10 @@ import (
 	"io"
 )
 
+func init() {
+	Register(MsgTypeShake, func() Message { return new(Shake) })
+}
+
 // Shake is the second part of the handshake.
 type Shake struct {
 	// Version is the version of the network on which is the sender.
@@ -13,13 +17,30 @@ type Shake struct {
 	// Capabilities represents client capabilities of the sender.
 	Capabilities Capabilities
 	// Hash is the hash of the genesis.
-	Hash [32]uint8
+	Hash Hash
 	// Total difficulty is the current total difficulty according to the sender.
 	TotalDifficulty uint64
 	// UserAgent is the user agent of the sender.
 	UserAgent string
 }
 
+// NewShake returns a new shake in reply to a hand.
+// The total difficulty is the one of the local chain and genesis is the hash of its genesis block.
+func NewShake(capabilities Capabilities, totalDifficulty uint64, genesis Hash) *Shake {
+	return &Shake{
+		Version:         ProtocolVersion1,
+		Capabilities:    capabilities,
+		Hash:            genesis,
+		TotalDifficulty: totalDifficulty,
+		UserAgent:       userAgent,
+	}
+}
+
+// Type returns the shake message type.
+func (s *Shake) Type() MsgType {
+	return MsgTypeShake
+}
+
 // Read populates the shake with values from the reader.
 func (s *Shake) Read(r io.Reader) error {
 	// Version.
@@ -39,6 +60,9 @@ func (s *Shake) Read(r io.Reader) error {
 	if err := binary.Read(r, binary.BigEndian, &len); err != nil {
 		return fmt.Errorf("could not read user agent length: %v", err)
 	}
+	if len > MaxMsgLen(MsgTypeShake) {
+		return fmt.Errorf("user agent too long: %v", len)
+	}
 	// User agent.
 	agent := make([]byte, len)
 	if err := binary.Read(r, binary.BigEndian, &agent); err != nil {
@@ -51,3 +75,38 @@ func (s *Shake) Read(r io.Reader) error {
 	}
 	return nil
 }
+
+// Write writes the shake values to the writer.
+func (s *Shake) Write(w io.Writer) error {
+	// Version.
+	if err := binary.Write(w, binary.BigEndian, s.Version); err != nil {
+		return fmt.Errorf("could not write version: %v", err)
+	}
+	// Capabilities.
+	if err := binary.Write(w, binary.BigEndian, s.Capabilities); err != nil {
+		return fmt.Errorf("could not write capabilities: %v", err)
+	}
+	// Total difficulty.
+	if err := binary.Write(w, binary.BigEndian, s.TotalDifficulty); err != nil {
+		return fmt.Errorf("could not write total difficulty: %v", err)
+	}
+	// User agent length.
+	agent := []byte(s.UserAgent)
+	if err := binary.Write(w, binary.BigEndian, uint64(len(agent))); err != nil {
+		return fmt.Errorf("could not write user agent length: %v", err)
+	}
+	// User agent.
+	if _, err := w.Write(agent); err != nil {
+		return fmt.Errorf("could not write user agent: %v", err)
+	}
+	// Genesis hash.
+	if err := binary.Write(w, binary.BigEndian, s.Hash); err != nil {
+		return fmt.Errorf("could not write genesis hash: %v", err)
+	}
+	return nil
+}
+
+// Len returns the length of the shake body.
+func (s *Shake) Len() uint64 {
+	return 4 + 4 + 8 + 8 + uint64(len(s.UserAgent)) + 32
+}
@@ -5,44 +5,70 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+)
+
+const (
+	// sockAddrIPv4 marks an IP v4 address.
+	sockAddrIPv4 uint8 = 0
+	// sockAddrIPv6 marks an IP v6 address.
+	sockAddrIPv6 uint8 = 1
 )
 
 // SockAddr represents an address.
 type SockAddr struct {
 	// Addr represents the address.
+	// Grin does not send the IP v6 zone, so it is never read or written.
 	Addr net.IPAddr
 	// Port is the port.
 	Port uint16
 }
 
+// NewSockAddr returns the sock address for the TCP address.
+func NewSockAddr(a *net.TCPAddr) SockAddr {
+	return SockAddr{
+		Addr: net.IPAddr{IP: a.IP, Zone: a.Zone},
+		Port: uint16(a.Port),
+	}
+}
+
+// TCPAddr returns the TCP address for the sock address.
+func (v SockAddr) TCPAddr() *net.TCPAddr {
+	return &net.TCPAddr{IP: v.Addr.IP, Port: int(v.Port), Zone: v.Addr.Zone}
+}
+
+// String returns the address as host:port, with IP v6 hosts in brackets.
+func (v SockAddr) String() string {
+	return net.JoinHostPort(v.Addr.String(), strconv.Itoa(int(v.Port)))
+}
+
 // Read reads the sock address in a format that is sent by Grin.
-func (v *SockAddr) Read(w io.Reader) error {
+func (v *SockAddr) Read(r io.Reader) error {
 	var t uint8
 	// Leading IP type.
-	if err := binary.Read(w, binary.BigEndian, &t); err != nil {
+	if err := binary.Read(r, binary.BigEndian, &t); err != nil {
 		return err
 	}
-	if t != 0 {
-		// TODO: Handle IPv6.
-		return nil
-	}
-	ip := make([]uint8, 4)
-	// IP v4 in the next 4 parts.
-	if err := binary.Read(w, binary.BigEndian, &ip[0]); err != nil {
-		return err
+	switch t {
+	case sockAddrIPv4:
+		// IP v4 in the next 4 parts.
+		ip := make([]uint8, net.IPv4len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return fmt.Errorf("could not read IP v4 address: %v", err)
+		}
+		v.Addr = net.IPAddr{IP: net.IPv4(ip[0], ip[1], ip[2], ip[3])}
+	case sockAddrIPv6:
+		// IP v6 in the next 8 big endian segments of 2 bytes.
+		ip := make([]uint8, net.IPv6len)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return fmt.Errorf("could not read IP v6 address: %v", err)
+		}
+		v.Addr = net.IPAddr{IP: ip}
+	default:
+		return fmt.Errorf("unknown IP type: %v", t)
 	}
-	if err := binary.Read(w, binary.BigEndian, &ip[1]); err != nil {
-		return err
-	}
-	if err := binary.Read(w, binary.BigEndian, &ip[2]); err != nil {
-		return err
-	}
-	if err := binary.Read(w, binary.BigEndian, &ip[3]); err != nil {
-		return err
-	}
-	v.Addr.IP = net.IPv4(ip[0], ip[1], ip[2], ip[3])
 	// Port.
-	if err := binary.Read(w, binary.BigEndian, &v.Port); err != nil {
+	if err := binary.Read(r, binary.BigEndian, &v.Port); err != nil {
 		return fmt.Errorf("could not read port: %v", err)
 	}
 	return nil
@@ -50,28 +76,27 @@ func (v *SockAddr) Read(w io.Reader) error {
 
 // Write writes the sock address in a format that is understood by Grin.
 func (v SockAddr) Write(w io.Writer) error {
-	// Convert to v4.
-	ip := v.Addr.IP.To4()
-	if ip == nil {
+	if ip := v.Addr.IP.To4(); ip != nil {
+		// Leading zero because this is IP v4.
+		if err := binary.Write(w, binary.BigEndian, sockAddrIPv4); err != nil {
+			return err
+		}
+		// IP v4 in the next 4 parts.
+		if _, err := w.Write(ip); err != nil {
+			return err
+		}
+	} else if ip := v.Addr.IP.To16(); ip != nil {
+		// Leading one because this is IP v6.
+		if err := binary.Write(w, binary.BigEndian, sockAddrIPv6); err != nil {
+			return err
+		}
+		// IP v6 in the next 16 parts.
+		if _, err := w.Write(ip); err != nil {
+			return err
+		}
+	} else {
 		return fmt.Errorf("invalid IP address")
 	}
-	// Leading zero because this is IP v4.
-	if err := binary.Write(w, binary.BigEndian, uint8(0)); err != nil {
-		return err
-	}
-	// IP v4 in the next 4 parts.
-	if err := binary.Write(w, binary.BigEndian, uint8(ip[0])); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.BigEndian, uint8(ip[1])); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.BigEndian, uint8(ip[2])); err != nil {
-		return err
-	}
-	if err := binary.Write(w, binary.BigEndian, uint8(ip[3])); err != nil {
-		return err
-	}
 	// Port.
 	if err := binary.Write(w, binary.BigEndian, v.Port); err != nil {
 		return fmt.Errorf("could not write port: %v", err)
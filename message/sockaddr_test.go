@@ -0,0 +1,61 @@
+package message
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestSockAddrRoundTrip(t *testing.T) {
+	tests := []struct {
+		addr string
+		len  int
+	}{
+		{"10.0.0.1:13414", 7},
+		{"[2001:db8::1]:13414", 19},
+		{"[::1]:1", 19},
+	}
+	for _, test := range tests {
+		a, err := net.ResolveTCPAddr("tcp", test.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := NewSockAddr(a)
+		var b bytes.Buffer
+		if err := v.Write(&b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != test.len {
+			t.Errorf("wrong length for %v: expecting %v, got %v", test.addr, test.len, b.Len())
+		}
+		var got SockAddr
+		if err := got.Read(&b); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.addr {
+			t.Errorf("wrong address: expecting %v, got %v", test.addr, got)
+		}
+	}
+}
+
+func TestReadIPv6SockAddr(t *testing.T) {
+	// Type, 8 segments and the port as sent by Grin.
+	b := []byte{1, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x02, 0x34, 0x66}
+	var v SockAddr
+	if err := v.Read(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "[2001:db8::2]:13414" {
+		t.Errorf("wrong address: %v", v)
+	}
+}
+
+func TestReadBadSockAddr(t *testing.T) {
+	var v SockAddr
+	if err := v.Read(bytes.NewReader([]byte{2, 0, 0, 0, 0, 0, 0})); err == nil {
+		t.Error("did not return error on unknown IP type")
+	}
+	if err := (SockAddr{}).Write(new(bytes.Buffer)); err == nil {
+		t.Error("did not return error on writing empty address")
+	}
+}
@@ -0,0 +1,62 @@
+package message
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// testnet2Headers is the file with headers of test network 2 as served by a node, in height order.
+// It holds a JSON array of objects with the height, the hash reported by the node and the header
+// encoded in hex as it is sent in a BlockHeaders message.
+const testnet2Headers = "testdata/testnet2_headers.json"
+
+// testnet2Header is a header of test network 2 and its hash reported by a node.
+type testnet2Header struct {
+	Height uint64
+	Hash   Hash
+	Header string
+}
+
+// loadTestnet2Headers returns the headers in testnet2Headers. The test is skipped if the file is missing.
+func loadTestnet2Headers(t *testing.T) []testnet2Header {
+	data, err := os.ReadFile(testnet2Headers)
+	if os.IsNotExist(err) {
+		t.Skipf("no headers of test network 2 in %v", testnet2Headers)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []testnet2Header
+	if err := json.Unmarshal(data, &headers); err != nil {
+		t.Fatal(err)
+	}
+	return headers
+}
+
+func TestTestnet2HeaderHash(t *testing.T) {
+	var previous Hash
+	for i, v := range loadTestnet2Headers(t) {
+		b, err := hex.DecodeString(v.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var h BlockHeader
+		if err := h.Read(bytes.NewReader(b)); err != nil {
+			t.Fatalf("could not read header at height %v: %v", v.Height, err)
+		}
+		var w bytes.Buffer
+		if err := h.Write(&w); err != nil || !bytes.Equal(w.Bytes(), b) {
+			t.Errorf("header at height %v not written back as read: %v", v.Height, err)
+		}
+		if h.Height != v.Height || h.Hash() != v.Hash {
+			t.Errorf("wrong hash at height %v: expecting %v, got %v", h.Height, v.Hash, h.Hash())
+		}
+		if i > 0 && h.Previous != previous {
+			t.Errorf("header at height %v does not follow the previous one", h.Height)
+		}
+		previous = v.Hash
+	}
+}
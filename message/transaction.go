@@ -0,0 +1,227 @@
+package message
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// CommitmentSize is the size of a Pedersen commitment.
+	CommitmentSize = 33
+	// SignatureSize is the size of an aggregated Schnorr signature.
+	SignatureSize = 64
+	// MaxProofSize is the maximum size of a range proof.
+	MaxProofSize = 5134
+)
+
+const (
+	// inputLen is the length of an encoded input.
+	inputLen = 1 + CommitmentSize
+	// outputMinLen is the length of an encoded output with an empty range proof.
+	outputMinLen = 1 + CommitmentSize + 8
+	// txKernelLen is the length of an encoded kernel.
+	txKernelLen = 1 + 8 + 8 + CommitmentSize + SignatureSize
+)
+
+// OutputFeatures are the features of an output.
+type OutputFeatures uint8
+
+const (
+	// DefaultOutputFeatures is a plain output.
+	DefaultOutputFeatures OutputFeatures = 0
+	// CoinbaseOutputFeatures is a coinbase output.
+	CoinbaseOutputFeatures OutputFeatures = 1 << 0
+)
+
+// KernelFeatures are the features of a kernel.
+type KernelFeatures uint8
+
+const (
+	// DefaultKernelFeatures is a plain kernel.
+	DefaultKernelFeatures KernelFeatures = 0
+	// CoinbaseKernelFeatures is a coinbase kernel.
+	CoinbaseKernelFeatures KernelFeatures = 1 << 0
+)
+
+// Input is a transaction input spending an output.
+type Input struct {
+	// Features are the features of the output being spent.
+	Features OutputFeatures
+	// Commit is the commitment of the output being spent.
+	Commit [CommitmentSize]uint8
+}
+
+// Read reads the input.
+func (v *Input) Read(r io.Reader) error {
+	// Features.
+	if err := binary.Read(r, binary.BigEndian, &v.Features); err != nil {
+		return fmt.Errorf("could not read features: %v", err)
+	}
+	// Commitment.
+	if err := binary.Read(r, binary.BigEndian, &v.Commit); err != nil {
+		return fmt.Errorf("could not read commitment: %v", err)
+	}
+	return nil
+}
+
+// Write writes the input.
+func (v Input) Write(w io.Writer) error {
+	// Features.
+	if err := binary.Write(w, binary.BigEndian, v.Features); err != nil {
+		return fmt.Errorf("could not write features: %v", err)
+	}
+	// Commitment.
+	if err := binary.Write(w, binary.BigEndian, v.Commit); err != nil {
+		return fmt.Errorf("could not write commitment: %v", err)
+	}
+	return nil
+}
+
+// Output is a transaction output.
+type Output struct {
+	// Features are the features of the output.
+	Features OutputFeatures
+	// Commit is the commitment to the value of the output.
+	Commit [CommitmentSize]uint8
+	// Proof is the range proof for the commitment.
+	Proof RangeProof
+}
+
+// Read reads the output.
+func (v *Output) Read(r io.Reader) error {
+	// Features.
+	if err := binary.Read(r, binary.BigEndian, &v.Features); err != nil {
+		return fmt.Errorf("could not read features: %v", err)
+	}
+	// Commitment.
+	if err := binary.Read(r, binary.BigEndian, &v.Commit); err != nil {
+		return fmt.Errorf("could not read commitment: %v", err)
+	}
+	// Range proof.
+	if err := v.Proof.Read(r); err != nil {
+		return fmt.Errorf("could not read range proof: %v", err)
+	}
+	return nil
+}
+
+// Write writes the output.
+func (v Output) Write(w io.Writer) error {
+	// Features.
+	if err := binary.Write(w, binary.BigEndian, v.Features); err != nil {
+		return fmt.Errorf("could not write features: %v", err)
+	}
+	// Commitment.
+	if err := binary.Write(w, binary.BigEndian, v.Commit); err != nil {
+		return fmt.Errorf("could not write commitment: %v", err)
+	}
+	// Range proof.
+	if err := v.Proof.Write(w); err != nil {
+		return fmt.Errorf("could not write range proof: %v", err)
+	}
+	return nil
+}
+
+// RangeProof is a proof that the value of a commitment is in range.
+type RangeProof struct {
+	// Proof is the proof.
+	Proof []uint8
+}
+
+// Read reads the range proof.
+func (v *RangeProof) Read(r io.Reader) error {
+	// Length.
+	var len uint64
+	if err := binary.Read(r, binary.BigEndian, &len); err != nil {
+		return fmt.Errorf("could not read length: %v", err)
+	}
+	if len > MaxProofSize {
+		return fmt.Errorf("range proof too long: %v", len)
+	}
+	// Proof.
+	v.Proof = make([]uint8, len)
+	if _, err := io.ReadFull(r, v.Proof); err != nil {
+		return fmt.Errorf("could not read proof: %v", err)
+	}
+	return nil
+}
+
+// Write writes the range proof.
+func (v RangeProof) Write(w io.Writer) error {
+	if len(v.Proof) > MaxProofSize {
+		return fmt.Errorf("range proof too long: %v", len(v.Proof))
+	}
+	// Length.
+	if err := binary.Write(w, binary.BigEndian, uint64(len(v.Proof))); err != nil {
+		return fmt.Errorf("could not write length: %v", err)
+	}
+	// Proof.
+	if _, err := w.Write(v.Proof); err != nil {
+		return fmt.Errorf("could not write proof: %v", err)
+	}
+	return nil
+}
+
+// TxKernel is a transaction kernel.
+type TxKernel struct {
+	// Features are the features of the kernel.
+	Features KernelFeatures
+	// Fee is the fee paid by the transaction.
+	Fee uint64
+	// LockHeight is the height from which the kernel can be included in a block.
+	LockHeight uint64
+	// Excess is the remainder of the sum of all transaction commitments.
+	Excess [CommitmentSize]uint8
+	// ExcessSig is the signature proving that the excess is a valid public key.
+	ExcessSig [SignatureSize]uint8
+}
+
+// Read reads the kernel.
+func (v *TxKernel) Read(r io.Reader) error {
+	// Features.
+	if err := binary.Read(r, binary.BigEndian, &v.Features); err != nil {
+		return fmt.Errorf("could not read features: %v", err)
+	}
+	// Fee.
+	if err := binary.Read(r, binary.BigEndian, &v.Fee); err != nil {
+		return fmt.Errorf("could not read fee: %v", err)
+	}
+	// Lock height.
+	if err := binary.Read(r, binary.BigEndian, &v.LockHeight); err != nil {
+		return fmt.Errorf("could not read lock height: %v", err)
+	}
+	// Excess.
+	if err := binary.Read(r, binary.BigEndian, &v.Excess); err != nil {
+		return fmt.Errorf("could not read excess: %v", err)
+	}
+	// Excess signature.
+	if err := binary.Read(r, binary.BigEndian, &v.ExcessSig); err != nil {
+		return fmt.Errorf("could not read excess signature: %v", err)
+	}
+	return nil
+}
+
+// Write writes the kernel.
+func (v TxKernel) Write(w io.Writer) error {
+	// Features.
+	if err := binary.Write(w, binary.BigEndian, v.Features); err != nil {
+		return fmt.Errorf("could not write features: %v", err)
+	}
+	// Fee.
+	if err := binary.Write(w, binary.BigEndian, v.Fee); err != nil {
+		return fmt.Errorf("could not write fee: %v", err)
+	}
+	// Lock height.
+	if err := binary.Write(w, binary.BigEndian, v.LockHeight); err != nil {
+		return fmt.Errorf("could not write lock height: %v", err)
+	}
+	// Excess.
+	if err := binary.Write(w, binary.BigEndian, v.Excess); err != nil {
+		return fmt.Errorf("could not write excess: %v", err)
+	}
+	// Excess signature.
+	if err := binary.Write(w, binary.BigEndian, v.ExcessSig); err != nil {
+		return fmt.Errorf("could not write excess signature: %v", err)
+	}
+	return nil
+}
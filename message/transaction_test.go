@@ -0,0 +1,67 @@
+package message
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func testInput() Input {
+	v := Input{Features: CoinbaseOutputFeatures}
+	v.Commit[0] = 1
+	return v
+}
+
+func testOutput() Output {
+	v := Output{Features: CoinbaseOutputFeatures, Proof: RangeProof{Proof: []uint8{1, 2, 3}}}
+	v.Commit[CommitmentSize-1] = 2
+	return v
+}
+
+func testTxKernel() TxKernel {
+	v := TxKernel{Features: CoinbaseKernelFeatures, Fee: 3, LockHeight: 4}
+	v.Excess[0] = 5
+	v.ExcessSig[SignatureSize-1] = 6
+	return v
+}
+
+func TestTransactionRoundTrip(t *testing.T) {
+	type rw interface {
+		Read(r io.Reader) error
+		Write(w io.Writer) error
+	}
+	tests := []struct {
+		v   rw
+		got rw
+		len int
+	}{
+		{func() rw { v := testInput(); return &v }(), new(Input), inputLen},
+		{func() rw { v := testOutput(); return &v }(), new(Output), outputMinLen + 3},
+		{func() rw { v := testTxKernel(); return &v }(), new(TxKernel), txKernelLen},
+		{&RangeProof{Proof: bytes.Repeat([]uint8{9}, MaxProofSize)}, new(RangeProof), 8 + MaxProofSize},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		if err := test.v.Write(&b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != test.len {
+			t.Errorf("wrong length of %T: expecting %v, got %v", test.v, test.len, b.Len())
+		}
+		if err := test.got.Read(&b); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.got, test.v) {
+			t.Errorf("wrong %T: expecting %v, got %v", test.v, test.v, test.got)
+		}
+	}
+}
+
+func TestRangeProofTooLong(t *testing.T) {
+	var b bytes.Buffer
+	v := RangeProof{Proof: make([]uint8, MaxProofSize+1)}
+	if err := v.Write(&b); err == nil {
+		t.Error("did not return error on writing range proof that is too long")
+	}
+}
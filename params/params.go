@@ -0,0 +1,134 @@
+// Package params describes the networks that the client can connect to.
+package params
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/seeds"
+)
+
+// Network holds the parameters of a network.
+type Network struct {
+	// Name is the name of the network.
+	Name string
+	// Magic1 is the first magic byte of every message header.
+	Magic1 uint8
+	// Magic2 is the second magic byte of every message header.
+	Magic2 uint8
+	// Port is the default port of the nodes.
+	Port uint16
+	// Genesis is the genesis block header.
+	// Only regtest defines it fully. Test network 2 only sets the fields used by the chain,
+	// so its GenesisHash cannot be computed from it and is taken as is.
+	Genesis message.BlockHeader
+	// GenesisHash is the hash of the genesis block.
+	GenesisHash message.Hash
+	// Seeds are the hosts to connect to first.
+	Seeds []string
+	// ProtocolVersion is the network protocol version.
+	ProtocolVersion message.ProtocolVersion
+	// InitialDifficulty is the difficulty of the first blocks.
+	InitialDifficulty uint64
+	// MinDifficulty is the least difficulty of a block.
+	MinDifficulty uint64
+	// SizeShift is the binary logarithm of the number of nodes of the Cuckoo graph of the proof of work.
+	// It is zero if the proof of work is not verified.
+	SizeShift uint8
+	// BlockTime is the target time between blocks.
+	BlockTime time.Duration
+	// CoinbaseMaturity is the number of blocks before a coinbase output can be spent.
+	CoinbaseMaturity uint64
+	// HardForks are the heights at which the header version goes up by one, starting from version 1.
+	HardForks []uint64
+}
+
+// Use makes the network the one in use by the message package.
+// It fails if another network is already in use.
+func (n *Network) Use() error {
+	return message.UseNetwork(n.Magic1, n.Magic2, n.GenesisHash)
+}
+
+// Testnet2 is the second Grin test network, whose wire format this client speaks.
+var Testnet2 = &Network{
+	Name:   "testnet2",
+	Magic1: 0x1e,
+	Magic2: 0xc5,
+	Port:   13414,
+	Genesis: message.BlockHeader{
+		Version:         1,
+		Timestamp:       time.Date(2018, 3, 26, 16, 0, 0, 0, time.UTC),
+		TotalDifficulty: 1000,
+	},
+	GenesisHash:       mustParseHash("3346f63cf5b25e14addd8855e2755784e55e612cd58561c8ca18d7cf6ca86f4b"),
+	Seeds:             seeds.Seeds(),
+	ProtocolVersion:   message.ProtocolVersion1,
+	InitialDifficulty: 1000,
+	MinDifficulty:     1,
+	SizeShift:         30,
+	BlockTime:         time.Minute,
+	CoinbaseMaturity:  1000,
+}
+
+// Regtest is a private network for local testing.
+// Its genesis block is fully defined here, so any number of local nodes agree on it.
+// The proof of work is not verified, so that headers can be made without mining.
+var Regtest = newRegtest()
+
+func newRegtest() *Network {
+	genesis := message.BlockHeader{
+		Version:         1,
+		Timestamp:       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		TotalDifficulty: 1,
+		ProofOfWork:     message.Proof{Nonces: make([]uint32, message.ProofSize)},
+	}
+	return &Network{
+		Name:              "regtest",
+		Magic1:            0x52,
+		Magic2:            0x54,
+		Port:              13415,
+		Genesis:           genesis,
+		GenesisHash:       genesis.Hash(),
+		Seeds:             []string{"127.0.0.1"},
+		ProtocolVersion:   message.ProtocolVersion1,
+		InitialDifficulty: 1,
+		MinDifficulty:     1,
+		BlockTime:         time.Minute,
+		CoinbaseMaturity:  3,
+	}
+}
+
+// networks are the known networks by name.
+var networks = map[string]*Network{
+	Testnet2.Name: Testnet2,
+	Regtest.Name:  Regtest,
+}
+
+// ByName returns the network with the name.
+func ByName(name string) (*Network, error) {
+	n, ok := networks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown network %q, expecting one of %v", name, Names())
+	}
+	return n, nil
+}
+
+// Names returns the names of the networks.
+func Names() []string {
+	var names []string
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func mustParseHash(s string) message.Hash {
+	h, err := message.ParseHash(s)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
@@ -0,0 +1,50 @@
+package params
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zkirill/gringo/message"
+)
+
+func TestByName(t *testing.T) {
+	for _, name := range Names() {
+		n, err := ByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.Name != name {
+			t.Errorf("wrong network: expecting %v, got %v", name, n.Name)
+		}
+		if n.GenesisHash.IsZero() || n.Port == 0 || len(n.Seeds) == 0 {
+			t.Errorf("incomplete network %v", name)
+		}
+	}
+	if _, err := ByName("moonnet"); err == nil {
+		t.Error("did not return error on unknown network")
+	}
+}
+
+func TestTestnet2(t *testing.T) {
+	// Test network 2 is the default of the message package.
+	if Testnet2.GenesisHash != message.GenesisHash() {
+		t.Errorf("wrong genesis hash: expecting %v, got %v", message.GenesisHash(), Testnet2.GenesisHash)
+	}
+	if magic1, magic2 := message.Magic(); Testnet2.Magic1 != magic1 || Testnet2.Magic2 != magic2 {
+		t.Error("wrong magic bytes")
+	}
+}
+
+func TestUse(t *testing.T) {
+	if err := Testnet2.Use(); err != nil {
+		t.Fatal(err)
+	}
+	// The network cannot change once in use.
+	if err := Regtest.Use(); !errors.Is(err, message.ErrNetworkInUse) {
+		t.Errorf("wrong error: expecting %v, got %v", message.ErrNetworkInUse, err)
+	}
+	h := message.Header{Magic1: Regtest.Magic1, Magic2: Regtest.Magic2, MsgType: message.MsgTypePing, Length: 16}
+	if err := h.Validate(); !errors.Is(err, message.ErrBadMagic) {
+		t.Errorf("wrong error: expecting %v, got %v", message.ErrBadMagic, err)
+	}
+}
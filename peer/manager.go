@@ -0,0 +1,534 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zkirill/gringo/addrbook"
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+var (
+	// ErrDuplicate is returned when adding a peer to which we are already connected.
+	ErrDuplicate = errors.New("already connected to peer")
+	// ErrBanned is returned when adding a peer that is banned.
+	ErrBanned = errors.New("peer banned")
+	// ErrTooManyInbound is returned when a peer connects to us while we have the maximum number of inbound peers.
+	ErrTooManyInbound = errors.New("too many inbound peers")
+)
+
+const (
+	// DefaultOutbound is the number of outbound connections kept when none is configured.
+	DefaultOutbound = 8
+	// DefaultMaxInbound is the maximum number of inbound connections when none is configured.
+	DefaultMaxInbound = 128
+	// DefaultMinBackoff is the initial delay before retrying an address that failed.
+	DefaultMinBackoff = 5 * time.Second
+	// DefaultMaxBackoff is the maximum delay before retrying an address that failed.
+	DefaultMaxBackoff = 10 * time.Minute
+	// DefaultInterval is how often the manager looks for new connections.
+	DefaultInterval = 5 * time.Second
+	// DefaultBanDuration is how long misbehaving peers are banned when no duration is configured.
+	DefaultBanDuration = 3 * time.Hour
+	// DefaultPingInterval is how often peers are pinged when no interval is configured.
+	DefaultPingInterval = 10 * time.Second
+	// DefaultPingTimeout is how long a peer has to answer a ping when no timeout is configured.
+	DefaultPingTimeout = 30 * time.Second
+	// SaveInterval is how often the address book and the ban list are saved.
+	SaveInterval = time.Minute
+)
+
+// maxScores is the number of IP addresses whose handshake misbehaviour is remembered.
+const maxScores = 1000
+
+// ManagerConfig configures a manager.
+type ManagerConfig struct {
+	// Handshake is our side of the handshake.
+	Handshake handshake.Config
+	// Handler handles messages received from every peer.
+	Handler Handler
+	// OnConnect is called with every new peer. It may be nil.
+	OnConnect func(p *Peer)
+	// Chain returns the total difficulty and height of our chain, sent in pings, pongs and hands.
+	// The total difficulty of the handshake config and a zero height are sent if nil.
+	Chain func() (totalDifficulty, height uint64)
+	// Timeouts are the dial, read, write and idle timeouts of the connections.
+	// The handshake timeout is part of the handshake config.
+	Timeouts Timeouts
+	// PingInterval is how often peers are pinged.
+	PingInterval time.Duration
+	// PingTimeout is how long a peer has to answer a ping before it is dropped.
+	PingTimeout time.Duration
+	// Outbound is the number of outbound connections to keep.
+	Outbound int
+	// MaxInbound is the maximum number of inbound connections.
+	MaxInbound int
+	// Seeds are the host:port addresses to connect to first.
+	Seeds []string
+	// Book is the address book supplying candidates. An in-memory book is used if nil.
+	Book *addrbook.Book
+	// Bans is the list of banned addresses. An in-memory list is used if nil.
+	Bans *addrbook.BanList
+	// BanDuration is how long misbehaving peers are banned.
+	BanDuration time.Duration
+	// MinBackoff is the initial delay before retrying an address that failed.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum delay before retrying an address that failed.
+	MaxBackoff time.Duration
+	// Interval is how often the manager looks for new connections.
+	Interval time.Duration
+}
+
+// retry is the connection history of an address that failed.
+type retry struct {
+	failures int
+	next     time.Time
+}
+
+// Manager keeps a number of outbound connections to peers alive and accepts inbound ones.
+// Peers are drawn from the address book, which is fed by the seeds and the addresses that peers send us.
+type Manager struct {
+	c ManagerConfig
+
+	mu sync.Mutex
+	// peers are the connected peers by address.
+	peers map[string]*Peer
+	// dialing are the addresses being dialed.
+	dialing map[string]struct{}
+	// accepting is the number of inbound connections in the handshake.
+	accepting int
+	// book holds the known addresses.
+	book *addrbook.Book
+	// retries are the addresses that failed.
+	retries map[string]*retry
+	// aliases map dialed addresses to the addresses of the peers.
+	aliases map[string]string
+	// self are the addresses that turned out to be our own.
+	self map[string]struct{}
+	// scores are the misbehaviour scores of IP addresses during the handshake.
+	scores map[string]int
+	// wake is signalled when a peer disconnects.
+	wake chan struct{}
+}
+
+// NewManager returns a new manager. Zero values in the config are replaced with defaults.
+func NewManager(c ManagerConfig) *Manager {
+	if c.Outbound <= 0 {
+		c.Outbound = DefaultOutbound
+	}
+	if c.MaxInbound <= 0 {
+		c.MaxInbound = DefaultMaxInbound
+	}
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = DefaultMinBackoff
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = DefaultMaxBackoff
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.PingInterval <= 0 {
+		c.PingInterval = DefaultPingInterval
+	}
+	if c.PingTimeout <= 0 {
+		c.PingTimeout = DefaultPingTimeout
+	}
+	if c.Book == nil {
+		c.Book = addrbook.New("")
+	}
+	if c.Bans == nil {
+		c.Bans = addrbook.NewBanList("")
+	}
+	if c.BanDuration <= 0 {
+		c.BanDuration = DefaultBanDuration
+	}
+	// The nonces of the hands we send are needed to recognise our own inbound connections.
+	if c.Handshake.Nonces == nil {
+		c.Handshake.Nonces = new(handshake.Nonces)
+	}
+	c.Book.AddAddrs(c.Seeds...)
+	return &Manager{
+		c:       c,
+		peers:   make(map[string]*Peer),
+		dialing: make(map[string]struct{}),
+		book:    c.Book,
+		retries: make(map[string]*retry),
+		aliases: make(map[string]string),
+		self:    make(map[string]struct{}),
+		scores:  make(map[string]int),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Run keeps the outbound connections alive and pings the peers until the context is cancelled.
+// The address book is saved periodically and once more before returning.
+func (m *Manager) Run(ctx context.Context) error {
+	t := time.NewTicker(m.c.Interval)
+	defer t.Stop()
+	ping := time.NewTicker(m.c.PingInterval)
+	defer ping.Stop()
+	save := time.NewTicker(SaveInterval)
+	defer save.Stop()
+	for {
+		m.connect(ctx)
+		select {
+		case <-ctx.Done():
+			m.save()
+			return ctx.Err()
+		case <-t.C:
+		case <-m.wake:
+		case <-ping.C:
+			m.ping()
+		case <-save.C:
+			m.save()
+		}
+	}
+}
+
+// chain returns the total difficulty and height of our chain.
+func (m *Manager) chain() (totalDifficulty, height uint64) {
+	if m.c.Chain == nil {
+		return m.c.Handshake.TotalDifficulty, 0
+	}
+	return m.c.Chain()
+}
+
+// handshake returns our side of the handshake with the current total difficulty of our chain.
+func (m *Manager) handshake() handshake.Config {
+	c := m.c.Handshake
+	c.TotalDifficulty, _ = m.chain()
+	return c
+}
+
+// ping pings every peer and drops those that did not answer the previous ping in time.
+func (m *Manager) ping() {
+	totalDifficulty, height := m.chain()
+	for _, p := range m.Peers() {
+		if err := p.Ping(totalDifficulty, height, m.c.PingTimeout); err != nil {
+			glog.Warningf("could not ping %v: %v", p, err)
+		}
+	}
+}
+
+// Serve accepts peers on the listener until the context is cancelled.
+// The listener is closed when Serve returns.
+func (m *Manager) Serve(ctx context.Context, l net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		l.Close()
+	}()
+	glog.Infof("listening on %v", l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("could not accept connection: %v", err)
+		}
+		go func() {
+			if err := m.accept(ctx, conn); err != nil {
+				conn.Close()
+				glog.Warningf("could not accept peer %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// accept performs the handshake on an inbound connection and adds the peer.
+func (m *Manager) accept(ctx context.Context, conn net.Conn) error {
+	if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok && m.c.Bans.IsBanned(remote.IP) {
+		return ErrBanned
+	}
+	m.mu.Lock()
+	if m.count(true)+m.accepting >= m.c.MaxInbound {
+		m.mu.Unlock()
+		return ErrTooManyInbound
+	}
+	m.accepting++
+	m.mu.Unlock()
+	// The handshake still counts against the maximum until the peer is added.
+	defer func() {
+		m.mu.Lock()
+		m.accepting--
+		m.mu.Unlock()
+	}()
+	info, err := handshake.Accept(conn, m.handshake())
+	if err != nil {
+		if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			m.misbehaved(remote.IP, err)
+		}
+		return fmt.Errorf("could not perform handshake: %w", err)
+	}
+	p := New(conn, info, m.handle)
+	p.Timeouts = m.c.Timeouts
+	p.Start(ctx)
+	return m.Add(p)
+}
+
+// count returns the number of inbound or outbound peers. The caller must hold mu.
+func (m *Manager) count(inbound bool) int {
+	n := 0
+	for _, p := range m.peers {
+		if p.Info.Inbound == inbound {
+			n++
+		}
+	}
+	return n
+}
+
+// save saves the address book and the ban list.
+func (m *Manager) save() {
+	if err := m.book.Save(); err != nil {
+		glog.Errorf("could not save address book: %v", err)
+	}
+	if err := m.c.Bans.Save(); err != nil {
+		glog.Errorf("could not save ban list: %v", err)
+	}
+}
+
+// Bans returns the current bans.
+func (m *Manager) Bans() []addrbook.Ban {
+	return m.c.Bans.List()
+}
+
+// Ban disconnects every peer with the IP address and bans it for the configured duration.
+func (m *Manager) Ban(ip net.IP, reason string) {
+	m.c.Bans.Ban(ip, m.c.BanDuration, reason)
+	for _, p := range m.Peers() {
+		if p.Addr().Addr.IP.Equal(ip) {
+			p.close(fmt.Errorf("%w: %v", ErrBanned, reason))
+		}
+	}
+	glog.Infof("banned %v for %v: %v", ip, m.c.BanDuration, reason)
+}
+
+// Lift lifts the ban on the IP address. It returns false if the address was not banned.
+func (m *Manager) Lift(ip net.IP) bool {
+	return m.c.Bans.Lift(ip)
+}
+
+// misbehaved adds the penalty of the violation that caused the handshake error, if any, to the score of the IP address.
+// The address is banned once its score reaches BanScore.
+func (m *Manager) misbehaved(ip net.IP, err error) {
+	v, ok := violationOf(err)
+	if !ok {
+		return
+	}
+	key := ip.String()
+	m.mu.Lock()
+	if _, ok := m.scores[key]; !ok && len(m.scores) >= maxScores {
+		// Forget the scores rather than grow without bound.
+		m.scores = make(map[string]int)
+	}
+	m.scores[key] += v.Penalty()
+	score := m.scores[key]
+	if score >= BanScore {
+		delete(m.scores, key)
+	}
+	m.mu.Unlock()
+	if score >= BanScore {
+		m.Ban(ip, fmt.Sprintf("%v during handshake", v))
+	}
+}
+
+// banned returns true if the host of the host:port address is a banned IP address.
+func (m *Manager) banned(addr string) bool {
+	ip := hostIP(addr)
+	return ip != nil && m.c.Bans.IsBanned(ip)
+}
+
+// hostIP returns the host of the host:port address if it is an IP address, or nil otherwise.
+func hostIP(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// AddCandidates adds addresses to connect to.
+func (m *Manager) AddCandidates(addrs ...message.SockAddr) {
+	m.book.Add(addrs...)
+}
+
+// Peers returns the connected peers.
+func (m *Manager) Peers() []*Peer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peers := make([]*Peer, 0, len(m.peers))
+	for _, p := range m.peers {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+// Add adds a started peer, such as one that connected to us.
+// The peer is closed and ErrDuplicate returned if we are already connected to it.
+func (m *Manager) Add(p *Peer) error {
+	addr := p.Addr().String()
+	if m.c.Bans.IsBanned(p.Addr().Addr.IP) {
+		p.Close()
+		return ErrBanned
+	}
+	m.mu.Lock()
+	if _, ok := m.peers[addr]; ok {
+		m.mu.Unlock()
+		p.Close()
+		return ErrDuplicate
+	}
+	m.peers[addr] = p
+	m.mu.Unlock()
+	glog.Infof("connected to %v (inbound %v)", addr, p.Info.Inbound)
+	if m.c.OnConnect != nil {
+		m.c.OnConnect(p)
+	}
+	go func() {
+		err := p.Wait()
+		glog.Infof("disconnected from %v: %v", addr, err)
+		if p.Score() >= BanScore {
+			m.Ban(p.Addr().Addr.IP, fmt.Sprintf("%v", p.Violations()))
+		}
+		m.mu.Lock()
+		if m.peers[addr] == p {
+			delete(m.peers, addr)
+		}
+		m.mu.Unlock()
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+	}()
+	return nil
+}
+
+// handle handles a message from a peer before passing it to the configured handler.
+// Pings are answered with our chain state and pongs complete the pings we sent.
+// Peer addresses go to the address book, which also answers requests for them.
+func (m *Manager) handle(p *Peer, msg message.Message) {
+	switch v := msg.(type) {
+	case *message.Ping:
+		p.update(v.TotalDifficulty, v.Height)
+		var r message.Pong
+		r.TotalDifficulty, r.Height = m.chain()
+		if err := p.Send(&r); err != nil {
+			glog.Warningf("could not send pong to %v: %v", p, err)
+		}
+	case *message.Pong:
+		p.pong(v)
+	case *message.PeerAddrs:
+		m.AddCandidates(v.Peers...)
+	case *message.GetPeerAddrs:
+		r := message.PeerAddrs{Peers: m.book.Sample(message.MaxPeerAddrs, v.Capabilities)}
+		if err := p.Send(&r); err != nil {
+			glog.Warningf("could not send peer addrs to %v: %v", p, err)
+		}
+	}
+	if m.c.Handler != nil {
+		m.c.Handler(p, msg)
+	}
+}
+
+// connect dials candidates until enough outbound connections are open or being opened.
+func (m *Manager) connect(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outbound := len(m.dialing) + m.count(false)
+	if outbound >= m.c.Outbound {
+		return
+	}
+	now := time.Now()
+	var addrs []string
+	for _, a := range m.book.Candidates() {
+		if _, ok := m.peers[a]; ok {
+			continue
+		}
+		if _, ok := m.peers[m.aliases[a]]; ok {
+			continue
+		}
+		if m.banned(a) || m.banned(m.aliases[a]) {
+			continue
+		}
+		if _, ok := m.dialing[a]; ok {
+			continue
+		}
+		if _, ok := m.self[a]; ok {
+			continue
+		}
+		if r, ok := m.retries[a]; ok && now.Before(r.next) {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	for _, a := range addrs {
+		if outbound >= m.c.Outbound {
+			break
+		}
+		outbound++
+		m.dialing[a] = struct{}{}
+		m.book.Attempt(a)
+		go m.dial(ctx, a)
+	}
+}
+
+// dial connects to the address and adds the peer.
+func (m *Manager) dial(ctx context.Context, addr string) {
+	p, err := Connect(ctx, addr, m.handshake(), m.c.Timeouts, m.handle)
+	m.mu.Lock()
+	delete(m.dialing, addr)
+	if errors.Is(err, handshake.ErrSelfConnection) {
+		m.self[addr] = struct{}{}
+		m.mu.Unlock()
+		m.book.Remove(addr)
+		glog.Infof("not connecting to %v again: %v", addr, err)
+		return
+	}
+	if err != nil {
+		r, ok := m.retries[addr]
+		if !ok {
+			r = &retry{}
+			m.retries[addr] = r
+		}
+		r.failures++
+		r.next = time.Now().Add(m.backoff(r.failures))
+		m.mu.Unlock()
+		m.book.Failure(addr)
+		if ip := hostIP(addr); ip != nil {
+			m.misbehaved(ip, err)
+		}
+		glog.Warningf("could not connect to %v (failure %v): %v", addr, r.failures, err)
+		return
+	}
+	delete(m.retries, addr)
+	// The dialed address may be a host name rather than the address of the peer.
+	m.aliases[addr] = p.Addr().String()
+	m.mu.Unlock()
+	m.book.Success(addr, p.Info.Capabilities)
+	if err := m.Add(p); err != nil {
+		glog.Warningf("could not add peer %v: %v", addr, err)
+	}
+}
+
+// backoff returns the delay before the next attempt after the failures.
+func (m *Manager) backoff(failures int) time.Duration {
+	d := m.c.MinBackoff
+	for i := 1; i < failures && d < m.c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > m.c.MaxBackoff {
+		d = m.c.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,231 @@
+package peer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+// testNode listens for peers and returns its address.
+// The accepted peers are sent on the channel.
+func testNode(t *testing.T, accepted chan<- *Peer) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			info, err := handshake.Accept(conn, handshake.Config{Genesis: message.GenesisHash()})
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			p := New(conn, info, nil)
+			p.Start(context.Background())
+			t.Cleanup(p.Close)
+			if accepted != nil {
+				accepted <- p
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+// waitFor waits until the condition is true.
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManager(t *testing.T) {
+	accepted := make(chan *Peer, 10)
+	// An address on which nobody listens.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := l.Addr().String()
+	l.Close()
+	m := NewManager(ManagerConfig{
+		Handshake: handshake.Config{Genesis: message.GenesisHash()},
+		Outbound:  2,
+		Seeds:     []string{testNode(t, accepted), testNode(t, accepted), dead},
+		Interval:  10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+	waitFor(t, func() bool { return len(m.Peers()) == 2 })
+	// Learn about a third node.
+	third := testNode(t, accepted)
+	a, err := net.ResolveTCPAddr("tcp", third)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddCandidates(message.NewSockAddr(a))
+	// Drop one of the peers and wait for the manager to replace it.
+	(<-accepted).Close()
+	waitFor(t, func() bool { return len(m.Peers()) == 2 && len(accepted) == 2 })
+	// No duplicates.
+	seen := make(map[string]bool)
+	for _, p := range m.Peers() {
+		if seen[p.String()] {
+			t.Errorf("duplicate peer %v", p)
+		}
+		seen[p.String()] = true
+	}
+}
+
+func TestManagerRetry(t *testing.T) {
+	// An address on which nobody listens.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := l.Addr().String()
+	l.Close()
+	m := NewManager(ManagerConfig{
+		Seeds:      []string{dead},
+		Interval:   10 * time.Millisecond,
+		MinBackoff: time.Hour,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+	failures := func() int {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if r, ok := m.retries[dead]; ok {
+			return r.failures
+		}
+		return 0
+	}
+	waitFor(t, func() bool { return failures() == 1 })
+	// The address is not retried before the backoff.
+	time.Sleep(50 * time.Millisecond)
+	if n := failures(); n != 1 {
+		t.Errorf("address retried during backoff: %v failures", n)
+	}
+}
+
+func TestManagerAddDuplicate(t *testing.T) {
+	m := NewManager(ManagerConfig{})
+	info := &handshake.PeerInfo{Inbound: true}
+	a, b := net.Pipe()
+	defer b.Close()
+	p := New(a, info, nil)
+	if err := m.Add(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add(New(b, info, nil)); err != ErrDuplicate {
+		t.Errorf("wrong error: expecting %v, got %v", ErrDuplicate, err)
+	}
+	p.Close()
+	waitFor(t, func() bool { return len(m.Peers()) == 0 })
+}
+
+func TestBackoff(t *testing.T) {
+	m := NewManager(ManagerConfig{MinBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for failures, want := range []time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if failures == 0 || want == 0 {
+			continue
+		}
+		if got := m.backoff(failures); got != want {
+			t.Errorf("wrong backoff after %v failures: expecting %v, got %v", failures, want, got)
+		}
+	}
+}
+
+func TestManagerPeerAddrs(t *testing.T) {
+	m := NewManager(ManagerConfig{})
+	p := New(nil, &handshake.PeerInfo{}, nil)
+	a, err := net.ResolveTCPAddr("tcp", "203.0.113.1:13414")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Learn an address and connect to it.
+	m.handle(p, &message.PeerAddrs{Peers: []message.SockAddr{message.NewSockAddr(a)}})
+	m.book.Attempt(a.String())
+	m.book.Success(a.String(), message.FullNodeCapabilities)
+	// Answer a request for addresses.
+	m.handle(p, &message.GetPeerAddrs{Capabilities: message.PeerListCapabilities})
+	select {
+	case msg := <-p.send:
+		v, ok := msg.(*message.PeerAddrs)
+		if !ok || len(v.Peers) != 1 || v.Peers[0].String() != a.String() {
+			t.Errorf("wrong reply: %v", msg)
+		}
+	default:
+		t.Fatal("no reply")
+	}
+}
+
+func TestManagerServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(ManagerConfig{
+		Handshake:  handshake.Config{Genesis: message.GenesisHash()},
+		MaxInbound: 1,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Serve(ctx, l)
+	c := handshake.Config{Genesis: message.GenesisHash(), ListenPort: 3414}
+	p, err := Connect(ctx, l.Addr().String(), c, Timeouts{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	waitFor(t, func() bool { return len(m.Peers()) == 1 })
+	if q := m.Peers()[0]; !q.Info.Inbound || q.Addr().Port != 3414 {
+		t.Errorf("wrong inbound peer: inbound %v, addr %v", q.Info.Inbound, q.Addr())
+	}
+	// The maximum number of inbound peers is reached.
+	if _, err := Connect(ctx, l.Addr().String(), c, Timeouts{}, nil); err == nil {
+		t.Error("connected over the maximum number of inbound peers")
+	}
+}
+
+func TestManagerSelfConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(ManagerConfig{
+		Handshake: handshake.Config{Genesis: message.GenesisHash()},
+		Seeds:     []string{l.Addr().String()},
+		Interval:  10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Serve(ctx, l)
+	go m.Run(ctx)
+	waitFor(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		_, ok := m.self[l.Addr().String()]
+		return ok
+	})
+	if n := len(m.Peers()); n != 0 {
+		t.Errorf("connected to self: %v peers", n)
+	}
+	if n := len(m.book.Candidates()); n != 0 {
+		t.Errorf("own address was kept in the book: %v candidates", n)
+	}
+}
@@ -0,0 +1,234 @@
+// Package peer is responsible for the connections to peers.
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+// SendQueueLen is the number of messages that can wait to be sent to a peer.
+const SendQueueLen = 64
+
+var (
+	// ErrQueueFull is returned when the send queue of a peer is full.
+	ErrQueueFull = errors.New("send queue full")
+	// ErrClosed is returned when sending to a peer that has been closed.
+	ErrClosed = errors.New("peer closed")
+)
+
+// Handler handles a message received from a peer.
+// Handlers are called from the reader goroutine of the peer, one message at a time.
+type Handler func(p *Peer, m message.Message)
+
+// Peer is a connection to a peer that completed the handshake.
+type Peer struct {
+	// Info is what was negotiated during the handshake.
+	Info *handshake.PeerInfo
+	// Timeouts are the read, write and idle timeouts of the connection. They must be set before Start.
+	Timeouts Timeouts
+
+	conn    net.Conn
+	handler Handler
+	// send is the queue of messages to send.
+	send chan message.Message
+	// done is closed once the peer is closed.
+	done chan struct{}
+	once sync.Once
+	// err is the reason why the peer was closed.
+	err error
+
+	// mu guards the fields below.
+	mu sync.Mutex
+	// score is the misbehaviour score.
+	score int
+	// violations are the protocol violations of the peer.
+	violations []Violation
+	// totalDifficulty and height are the last chain state advertised by the peer.
+	totalDifficulty uint64
+	height          uint64
+	// pingSent is when the unanswered ping was sent, or zero.
+	pingSent time.Time
+	// latency is the round-trip time of the last answered ping.
+	latency time.Duration
+}
+
+// New returns a peer for the connection on which the handshake has been performed.
+// Messages received from the peer are passed to the handler once the peer is started.
+func New(conn net.Conn, info *handshake.PeerInfo, handler Handler) *Peer {
+	return &Peer{
+		Info:            info,
+		conn:            conn,
+		handler:         handler,
+		send:            make(chan message.Message, SendQueueLen),
+		done:            make(chan struct{}),
+		totalDifficulty: info.TotalDifficulty,
+	}
+}
+
+// Connect dials the address, performs the handshake and returns the started peer.
+func Connect(ctx context.Context, addr string, c handshake.Config, t Timeouts, handler Handler) (*Peer, error) {
+	t = t.withDefaults()
+	d := net.Dialer{Timeout: t.Dial}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && ctx.Err() == nil {
+			return nil, fmt.Errorf("could not connect to %v: %w: %v", addr, ErrDialTimeout, err)
+		}
+		return nil, fmt.Errorf("could not connect to %v: %v", addr, err)
+	}
+	info, err := handshake.Initiate(conn, c)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not perform handshake with %v: %w", addr, err)
+	}
+	p := New(conn, info, handler)
+	p.Timeouts = t
+	p.Start(ctx)
+	return p, nil
+}
+
+// Start starts the reader and writer goroutines.
+// The peer is closed when the context is cancelled.
+func (p *Peer) Start(ctx context.Context) {
+	t := p.Timeouts.withDefaults()
+	go p.readLoop(t)
+	go p.writeLoop(t)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.close(ctx.Err())
+		case <-p.done:
+		}
+	}()
+}
+
+// Addr returns the address of the peer.
+func (p *Peer) Addr() message.SockAddr {
+	return p.Info.Addr
+}
+
+// String returns the address of the peer.
+func (p *Peer) String() string {
+	return p.Addr().String()
+}
+
+// Send queues the message to be sent to the peer.
+// It does not block and returns ErrQueueFull if the queue is full.
+func (p *Peer) Send(m message.Message) error {
+	select {
+	case <-p.done:
+		return ErrClosed
+	default:
+	}
+	select {
+	case p.send <- m:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close closes the connection to the peer.
+func (p *Peer) Close() {
+	p.close(ErrClosed)
+}
+
+// Done returns a channel that is closed once the peer is closed.
+func (p *Peer) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the reason why the peer was closed, or nil if it is still open.
+func (p *Peer) Err() error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the peer is closed and returns the reason.
+func (p *Peer) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// close closes the peer once with the reason.
+func (p *Peer) close(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.done)
+		p.conn.Close()
+	})
+}
+
+// readLoop reads messages from the peer and passes them to the handler.
+func (p *Peer) readLoop(t Timeouts) {
+	r := &deadlineReader{conn: p.conn, t: t}
+	for {
+		if err := r.next(); err != nil {
+			p.close(fmt.Errorf("could not set read deadline: %v", err))
+			return
+		}
+		m, err := message.ReadMessage(r)
+		var bodyErr *message.BodyError
+		if errors.As(err, &bodyErr) {
+			// The stream is still aligned on the next message.
+			glog.Warningf("skipping bad message from %v: %v", p, err)
+			p.Misbehave(MalformedMessage)
+			continue
+		}
+		if err != nil {
+			if v, ok := violationOf(err); ok {
+				p.Misbehave(v)
+			}
+			if terr := r.timeout(err); terr != nil {
+				err = fmt.Errorf("%w: %v", terr, err)
+			}
+			p.close(fmt.Errorf("could not read message: %w", err))
+			return
+		}
+		switch m.(type) {
+		case *message.Hand, *message.Shake:
+			// The handshake is already done.
+			p.Misbehave(UnexpectedMessage)
+			continue
+		}
+		if p.handler != nil {
+			p.handler(p, m)
+		}
+	}
+}
+
+// writeLoop writes the queued messages to the peer.
+func (p *Peer) writeLoop(t Timeouts) {
+	for {
+		select {
+		case <-p.done:
+			return
+		case m := <-p.send:
+			if err := p.conn.SetWriteDeadline(time.Now().Add(t.Write)); err != nil {
+				p.close(fmt.Errorf("could not set write deadline: %v", err))
+				return
+			}
+			if err := message.WriteMessage(p.conn, m); err != nil {
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					err = fmt.Errorf("%w: %v", ErrWriteTimeout, err)
+				}
+				p.close(fmt.Errorf("could not write message: %w", err))
+				return
+			}
+		}
+	}
+}
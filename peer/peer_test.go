@@ -0,0 +1,115 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+// testPeers returns two started peers connected to each other.
+// Only the first peer is closed when the context is cancelled.
+func testPeers(t *testing.T, ctx context.Context, a, b Handler) (*Peer, *Peer) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan *Peer, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		info, err := handshake.Accept(conn, handshake.Config{Genesis: message.GenesisHash()})
+		if err != nil {
+			conn.Close()
+			accepted <- nil
+			return
+		}
+		p := New(conn, info, b)
+		p.Start(context.Background())
+		accepted <- p
+	}()
+	pa, err := Connect(ctx, l.Addr().String(), handshake.Config{Genesis: message.GenesisHash()}, Timeouts{}, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb := <-accepted
+	if pb == nil {
+		t.Fatal("could not accept peer")
+	}
+	t.Cleanup(func() {
+		pa.Close()
+		pb.Close()
+	})
+	return pa, pb
+}
+
+func TestSendReceive(t *testing.T) {
+	received := make(chan message.Message, 1)
+	// b replies to pings with pongs.
+	b := func(p *Peer, m message.Message) {
+		if ping, ok := m.(*message.Ping); ok {
+			p.Send(&message.Pong{Height: ping.Height})
+		}
+	}
+	a := func(p *Peer, m message.Message) {
+		received <- m
+	}
+	pa, _ := testPeers(t, context.Background(), a, b)
+	if err := pa.Send(&message.Ping{Height: 7}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-received:
+		if pong, ok := m.(*message.Pong); !ok || pong.Height != 7 {
+			t.Errorf("wrong reply: %v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pa, pb := testPeers(t, ctx, nil, nil)
+	cancel()
+	if err := pa.Wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error: expecting %v, got %v", context.Canceled, err)
+	}
+	pb.Wait()
+	if err := pa.Send(&message.Ping{}); err != ErrClosed {
+		t.Errorf("wrong error: expecting %v, got %v", ErrClosed, err)
+	}
+}
+
+func TestRemoteClose(t *testing.T) {
+	pa, pb := testPeers(t, context.Background(), nil, nil)
+	pb.Close()
+	select {
+	case <-pa.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer not closed after remote close")
+	}
+	if pa.Err() == nil {
+		t.Error("closed peer has no error")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	p := New(nil, &handshake.PeerInfo{}, nil)
+	for i := 0; i < SendQueueLen; i++ {
+		if err := p.Send(&message.Ping{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Send(&message.Ping{}); err != ErrQueueFull {
+		t.Errorf("wrong error: expecting %v, got %v", ErrQueueFull, err)
+	}
+}
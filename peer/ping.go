@@ -0,0 +1,86 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+)
+
+// ErrPingTimeout is returned when a peer did not answer a ping in time.
+var ErrPingTimeout = errors.New("ping timed out")
+
+// Ping sends a ping carrying our total difficulty and height.
+// If the previous ping is still unanswered after the timeout, the peer is closed and ErrPingTimeout returned instead.
+func (p *Peer) Ping(totalDifficulty, height uint64, timeout time.Duration) error {
+	now := time.Now()
+	p.mu.Lock()
+	sent := p.pingSent
+	if !sent.IsZero() && now.Sub(sent) >= timeout {
+		p.mu.Unlock()
+		err := fmt.Errorf("%w: no pong after %v", ErrPingTimeout, now.Sub(sent))
+		p.close(err)
+		return err
+	}
+	if !sent.IsZero() {
+		// Wait for the pong of the previous ping.
+		p.mu.Unlock()
+		return nil
+	}
+	// Mark the ping as sent before sending it so that a fast pong finds it.
+	p.pingSent = now
+	p.mu.Unlock()
+	if err := p.Send(&message.Ping{TotalDifficulty: totalDifficulty, Height: height}); err != nil {
+		p.mu.Lock()
+		p.pingSent = time.Time{}
+		p.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// pong records the chain state in the pong and the latency of the ping it answers.
+func (p *Peer) pong(m *message.Pong) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateLocked(m.TotalDifficulty, m.Height)
+	if !p.pingSent.IsZero() {
+		p.latency = time.Since(p.pingSent)
+		p.pingSent = time.Time{}
+	}
+}
+
+// update records the total difficulty and height advertised by the peer.
+func (p *Peer) update(totalDifficulty, height uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.updateLocked(totalDifficulty, height)
+}
+
+// updateLocked is update with mu held.
+func (p *Peer) updateLocked(totalDifficulty, height uint64) {
+	p.totalDifficulty = totalDifficulty
+	p.height = height
+}
+
+// TotalDifficulty returns the last total difficulty advertised by the peer.
+func (p *Peer) TotalDifficulty() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.totalDifficulty
+}
+
+// Height returns the last height advertised by the peer, or zero if it has not sent one yet.
+func (p *Peer) Height() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.height
+}
+
+// Latency returns the round-trip time of the last answered ping, or zero if none was answered yet.
+func (p *Peer) Latency() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.latency
+}
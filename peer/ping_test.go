@@ -0,0 +1,42 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	ma := NewManager(ManagerConfig{Chain: func() (uint64, uint64) { return 10, 1 }})
+	mb := NewManager(ManagerConfig{Chain: func() (uint64, uint64) { return 20, 2 }})
+	a, b := testPeers(t, context.Background(), ma.handle, mb.handle)
+	if err := a.Ping(10, 1, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return a.Latency() > 0 })
+	if a.TotalDifficulty() != 20 || a.Height() != 2 {
+		t.Errorf("wrong chain state from pong: difficulty %v, height %v", a.TotalDifficulty(), a.Height())
+	}
+	if b.TotalDifficulty() != 10 || b.Height() != 1 {
+		t.Errorf("wrong chain state from ping: difficulty %v, height %v", b.TotalDifficulty(), b.Height())
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	// b does not answer pings.
+	a, _ := testPeers(t, context.Background(), nil, nil)
+	if err := a.Ping(0, 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	// The previous ping is still within the timeout.
+	if err := a.Ping(0, 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Ping(0, 0, 0); !errors.Is(err, ErrPingTimeout) {
+		t.Fatalf("wrong error: expecting %v, got %v", ErrPingTimeout, err)
+	}
+	if err := a.Wait(); !errors.Is(err, ErrPingTimeout) {
+		t.Errorf("wrong close reason: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+// BanScore is the misbehaviour score at which a peer is disconnected and banned.
+const BanScore = 100
+
+// ErrMisbehaving is returned when a peer is closed because its misbehaviour score reached BanScore.
+var ErrMisbehaving = errors.New("peer misbehaving")
+
+// Violation is a protocol violation by a peer.
+type Violation int
+
+const (
+	// BadMagic is a message header with wrong magic bytes.
+	BadMagic Violation = iota
+	// UnknownMessage is a message of an unknown type.
+	UnknownMessage
+	// OversizedMessage is a message larger than allowed for its type.
+	OversizedMessage
+	// MalformedMessage is a message body that could not be decoded.
+	MalformedMessage
+	// InvalidHeader is a block header that failed validation.
+	InvalidHeader
+	// InvalidBlock is a block that failed validation.
+	InvalidBlock
+	// UnexpectedMessage is a message that was not expected, such as a second hand.
+	UnexpectedMessage
+)
+
+// penalties are the scores added for each violation.
+var penalties = map[Violation]int{
+	BadMagic:          BanScore,
+	UnknownMessage:    BanScore / 2,
+	OversizedMessage:  BanScore,
+	MalformedMessage:  BanScore / 4,
+	InvalidHeader:     BanScore / 2,
+	InvalidBlock:      BanScore,
+	UnexpectedMessage: BanScore / 10,
+}
+
+// violationNames are the names of the violations.
+var violationNames = map[Violation]string{
+	BadMagic:          "bad magic",
+	UnknownMessage:    "unknown message",
+	OversizedMessage:  "oversized message",
+	MalformedMessage:  "malformed message",
+	InvalidHeader:     "invalid header",
+	InvalidBlock:      "invalid block",
+	UnexpectedMessage: "unexpected message",
+}
+
+// Penalty returns the score added for the violation.
+func (v Violation) Penalty() int {
+	return penalties[v]
+}
+
+func (v Violation) String() string {
+	if s, ok := violationNames[v]; ok {
+		return s
+	}
+	return fmt.Sprintf("violation %d", int(v))
+}
+
+// violationOf returns the violation that caused the error reading a message or performing the handshake.
+func violationOf(err error) (Violation, bool) {
+	var bodyErr *message.BodyError
+	switch {
+	case errors.Is(err, message.ErrBadMagic):
+		return BadMagic, true
+	case errors.Is(err, message.ErrUnknownMsgType):
+		return UnknownMessage, true
+	case errors.Is(err, message.ErrMsgTooLarge):
+		return OversizedMessage, true
+	case errors.As(err, &bodyErr):
+		return MalformedMessage, true
+	case errors.Is(err, handshake.ErrUnexpectedMessage):
+		return UnexpectedMessage, true
+	}
+	return 0, false
+}
+
+// Misbehave adds the penalty of the violation to the score of the peer.
+// The peer is closed once the score reaches BanScore.
+func (p *Peer) Misbehave(v Violation) {
+	p.mu.Lock()
+	p.score += v.Penalty()
+	score := p.score
+	p.violations = append(p.violations, v)
+	p.mu.Unlock()
+	if score >= BanScore {
+		p.close(fmt.Errorf("%w: %v", ErrMisbehaving, v))
+	}
+}
+
+// Score returns the misbehaviour score of the peer.
+func (p *Peer) Score() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.score
+}
+
+// Violations returns the violations of the peer, oldest first.
+func (p *Peer) Violations() []Violation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Violation(nil), p.violations...)
+}
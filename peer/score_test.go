@@ -0,0 +1,134 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+func TestMisbehave(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	p := New(a, &handshake.PeerInfo{}, nil)
+	p.Misbehave(MalformedMessage)
+	p.Misbehave(UnexpectedMessage)
+	if p.Score() != MalformedMessage.Penalty()+UnexpectedMessage.Penalty() || p.Err() != nil {
+		t.Errorf("wrong score %v or closed peer: %v", p.Score(), p.Err())
+	}
+	p.Misbehave(InvalidBlock)
+	if !errors.Is(p.Err(), ErrMisbehaving) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrMisbehaving, p.Err())
+	}
+}
+
+func TestReadViolations(t *testing.T) {
+	magic1, magic2 := message.Magic()
+	tests := []struct {
+		h rawHeader
+		v Violation
+	}{
+		{rawHeader{0, 0, message.MsgTypePing, 16}, BadMagic},
+		{rawHeader{magic1, magic2, message.MsgTypePing, 17}, OversizedMessage},
+		{rawHeader{magic1, magic2, 200, 0}, UnknownMessage},
+	}
+	for _, test := range tests {
+		pa, pb := testPeers(t, context.Background(), nil, nil)
+		if err := test.h.write(pb.conn); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-pa.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("peer not closed")
+		}
+		if v := pa.Violations(); len(v) != 1 || v[0] != test.v {
+			t.Errorf("wrong violations: expecting %v, got %v", test.v, v)
+		}
+	}
+}
+
+func TestUnexpectedHandshake(t *testing.T) {
+	pa, pb := testPeers(t, context.Background(), nil, nil)
+	if err := pb.Send(message.NewShake(0, 1, message.GenesisHash())); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(pa.Violations()) == 1 })
+	if v := pa.Violations(); v[0] != UnexpectedMessage || pa.Err() != nil {
+		t.Errorf("wrong violations %v or closed peer: %v", v, pa.Err())
+	}
+}
+
+func TestManagerHandshakeBan(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(ManagerConfig{Handshake: handshake.Config{Genesis: message.GenesisHash()}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Serve(ctx, l)
+	// Each ping instead of a hand adds a small penalty until the address is banned.
+	n := BanScore / UnexpectedMessage.Penalty()
+	for i := 0; i < n; i++ {
+		if len(m.Bans()) != 0 {
+			t.Fatalf("banned after %v of %v unexpected messages", i, n)
+		}
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := message.WriteMessage(conn, &message.Ping{}); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the manager to drop the connection.
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	waitFor(t, func() bool { return len(m.Bans()) == 1 })
+	if bans := m.Bans(); bans[0].IP != "127.0.0.1" {
+		t.Errorf("wrong ban: %v", bans)
+	}
+}
+
+func TestManagerBan(t *testing.T) {
+	accepted := make(chan *Peer, 10)
+	m := NewManager(ManagerConfig{
+		Handshake: handshake.Config{Genesis: message.GenesisHash()},
+		Outbound:  1,
+		Seeds:     []string{testNode(t, accepted)},
+		Interval:  10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+	// The node sends garbage.
+	p := <-accepted
+	(&rawHeader{0, 0, message.MsgTypePing, 16}).write(p.conn)
+	waitFor(t, func() bool { return len(m.Bans()) == 1 })
+	ip := net.ParseIP("127.0.0.1")
+	if bans := m.Bans(); bans[0].IP != ip.String() {
+		t.Errorf("wrong ban: %v", bans)
+	}
+	// The node is not dialed again while banned.
+	time.Sleep(50 * time.Millisecond)
+	if len(m.Peers()) != 0 || len(accepted) != 0 {
+		t.Error("banned node dialed again")
+	}
+	if !m.Lift(ip) {
+		t.Error("ban not lifted")
+	}
+}
+
+// rawHeader is a message header that may be invalid.
+type rawHeader message.Header
+
+// write writes the header as is.
+func (h *rawHeader) write(conn net.Conn) error {
+	_, err := conn.Write([]byte{h.Magic1, h.Magic2, uint8(h.MsgType), 0, 0, 0, 0, 0, 0, 0, uint8(h.Length)})
+	return err
+}
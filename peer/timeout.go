@@ -0,0 +1,103 @@
+package peer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultDialTimeout is the time allowed to open a connection when none is configured.
+	DefaultDialTimeout = 10 * time.Second
+	// DefaultReadTimeout is the time allowed to read a message once it started arriving when none is configured.
+	DefaultReadTimeout = 30 * time.Second
+	// DefaultWriteTimeout is the time allowed to write a message when none is configured.
+	DefaultWriteTimeout = 30 * time.Second
+	// DefaultIdleTimeout is the time allowed between messages when none is configured.
+	// Peers ping every few seconds, so a peer silent for this long is gone.
+	DefaultIdleTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrDialTimeout is returned when a connection could not be opened in time.
+	ErrDialTimeout = errors.New("dial timed out")
+	// ErrReadTimeout is returned when a message that started arriving was not read in time.
+	ErrReadTimeout = errors.New("read timed out")
+	// ErrWriteTimeout is returned when a message was not written in time.
+	ErrWriteTimeout = errors.New("write timed out")
+	// ErrIdleTimeout is returned when a peer sent nothing for too long.
+	ErrIdleTimeout = errors.New("peer idle")
+)
+
+// Timeouts are the times allowed for the operations on a connection.
+// Defaults are used for zero values.
+type Timeouts struct {
+	// Dial is the time allowed to open a connection.
+	Dial time.Duration
+	// Read is the time allowed to read a message once its first byte arrived.
+	Read time.Duration
+	// Write is the time allowed to write a message.
+	Write time.Duration
+	// Idle is the time allowed between messages.
+	Idle time.Duration
+}
+
+// withDefaults returns the timeouts with zero values replaced with defaults.
+func (t Timeouts) withDefaults() Timeouts {
+	if t.Dial <= 0 {
+		t.Dial = DefaultDialTimeout
+	}
+	if t.Read <= 0 {
+		t.Read = DefaultReadTimeout
+	}
+	if t.Write <= 0 {
+		t.Write = DefaultWriteTimeout
+	}
+	if t.Idle <= 0 {
+		t.Idle = DefaultIdleTimeout
+	}
+	return t
+}
+
+// deadlineReader reads messages from a connection.
+// The idle timeout applies until the first byte of a message arrives and the read timeout to the rest of it.
+type deadlineReader struct {
+	conn net.Conn
+	t    Timeouts
+	// started is true once the first byte of the message has been read.
+	started bool
+}
+
+// next prepares the reader for the next message.
+func (r *deadlineReader) next() error {
+	r.started = false
+	return r.setDeadline(r.t.Idle)
+}
+
+// setDeadline sets the read deadline to the timeout from now.
+func (r *deadlineReader) setDeadline(timeout time.Duration) error {
+	return r.conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+func (r *deadlineReader) Read(b []byte) (int, error) {
+	n, err := r.conn.Read(b)
+	if n > 0 && !r.started {
+		r.started = true
+		if derr := r.setDeadline(r.t.Read); derr != nil && err == nil {
+			err = derr
+		}
+	}
+	return n, err
+}
+
+// timeout returns ErrIdleTimeout or ErrReadTimeout if the read failed because the deadline passed, nil otherwise.
+func (r *deadlineReader) timeout(err error) error {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	if r.started {
+		return ErrReadTimeout
+	}
+	return ErrIdleTimeout
+}
@@ -0,0 +1,64 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+)
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts Timeouts
+		// remote acts on the other end of the connection.
+		remote func(conn net.Conn, p *Peer)
+		want   error
+	}{
+		{"idle", Timeouts{Idle: 50 * time.Millisecond}, func(net.Conn, *Peer) {}, ErrIdleTimeout},
+		{"read", Timeouts{Read: 50 * time.Millisecond}, func(conn net.Conn, _ *Peer) {
+			// Only part of a header.
+			magic1, magic2 := message.Magic()
+			conn.Write([]byte{magic1, magic2})
+		}, ErrReadTimeout},
+		{"write", Timeouts{Write: 50 * time.Millisecond}, func(_ net.Conn, p *Peer) {
+			// Nobody reads the ping.
+			p.Send(&message.Ping{})
+		}, ErrWriteTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer b.Close()
+			p := New(a, &handshake.PeerInfo{}, nil)
+			p.Timeouts = tt.timeouts
+			p.Start(context.Background())
+			defer p.Close()
+			go tt.remote(b, p)
+			select {
+			case <-p.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("peer not closed")
+			}
+			if err := p.Err(); !errors.Is(err, tt.want) {
+				t.Errorf("wrong error: expecting %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestClosedIsNotTimeout(t *testing.T) {
+	a, b := net.Pipe()
+	p := New(a, &handshake.PeerInfo{}, nil)
+	p.Timeouts = Timeouts{Idle: time.Millisecond}
+	// The remote goes away before the idle timeout would have passed for a slow reader.
+	b.Close()
+	p.Start(context.Background())
+	if err := p.Wait(); errors.Is(err, ErrIdleTimeout) || errors.Is(err, ErrReadTimeout) {
+		t.Errorf("closed connection reported as timeout: %v", err)
+	}
+}
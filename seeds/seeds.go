@@ -1,7 +1,7 @@
 // Package seeds is responsible for listing seeds.
 package seeds
 
-// Seeds returns network seeds from http://grin-tech.org/seeds.txt.
+// Seeds returns the seeds of test network 2 from http://grin-tech.org/seeds.txt.
 func Seeds() []string {
 	return []string{
 		"192.241.160.172",
@@ -10,7 +10,3 @@ func Seeds() []string {
 		"46.4.91.48",
 	}
 }
-
-// InitialDifficulty is the initial block difficulty for testnet 2.
-// TODO: Move this to the appropriate package.
-const InitialDifficulty uint64 = 1000
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/zkirill/gringo/addrbook"
+	"github.com/zkirill/gringo/message"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the database.
+var (
+	metaBucket    = []byte("meta")
+	headersBucket = []byte("headers")
+	blocksBucket  = []byte("blocks")
+	heightsBucket = []byte("heights")
+	addrsBucket   = []byte("addrs")
+	bansBucket    = []byte("bans")
+)
+
+// versionKey is the key of the schema version in the meta bucket.
+var versionKey = []byte("version")
+
+// Bolt is a store in an embedded bbolt database file.
+type Bolt struct {
+	db *bolt.DB
+}
+
+var _ Store = (*Bolt)(nil)
+
+// Open opens the database file at the path, creating it if it does not exist.
+// ErrSchemaVersion is returned if the file was written with another schema version.
+func Open(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metaBucket, headersBucket, blocksBucket, heightsBucket, addrsBucket, bansBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return fmt.Errorf("could not create bucket %s: %v", name, err)
+			}
+		}
+		meta := tx.Bucket(metaBucket)
+		v := meta.Get(versionKey)
+		if v == nil {
+			return meta.Put(versionKey, encodeUint64(SchemaVersion))
+		}
+		if version := binary.BigEndian.Uint64(v); version != SchemaVersion {
+			return fmt.Errorf("%w: %v, expecting %v", ErrSchemaVersion, version, SchemaVersion)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Bolt) Close() error {
+	return s.db.Close()
+}
+
+// Header returns the header with the hash.
+func (s *Bolt) Header(hash message.Hash) (message.BlockHeader, error) {
+	var h message.BlockHeader
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(headersBucket).Get(hash[:])
+		if v == nil {
+			return fmt.Errorf("header %v: %w", hash, ErrNotFound)
+		}
+		return h.Read(bytes.NewReader(v))
+	})
+	return h, err
+}
+
+// ForEachHeader calls f with every stored header.
+func (s *Bolt) ForEachHeader(f func(h *message.BlockHeader) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(headersBucket).ForEach(func(k, v []byte) error {
+			var h message.BlockHeader
+			if err := h.Read(bytes.NewReader(v)); err != nil {
+				return fmt.Errorf("could not read header %x: %v", k, err)
+			}
+			return f(&h)
+		})
+	})
+}
+
+// Block returns the block with the hash.
+func (s *Bolt) Block(hash message.Hash) (*message.Block, error) {
+	var b message.Block
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(blocksBucket).Get(hash[:])
+		if v == nil {
+			return fmt.Errorf("block %v: %w", hash, ErrNotFound)
+		}
+		return b.Read(bytes.NewReader(v))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// HasBlock returns true if the block with the hash is stored.
+func (s *Bolt) HasBlock(hash message.Hash) (bool, error) {
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		ok = tx.Bucket(blocksBucket).Get(hash[:]) != nil
+		return nil
+	})
+	return ok, err
+}
+
+// HashAt returns the hash of the block at the height on the best chain.
+func (s *Bolt) HashAt(height uint64) (message.Hash, error) {
+	var hash message.Hash
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(heightsBucket).Get(encodeUint64(height))
+		if v == nil {
+			return fmt.Errorf("height %v: %w", height, ErrNotFound)
+		}
+		copy(hash[:], v)
+		return nil
+	})
+	return hash, err
+}
+
+// Height returns the height of the best chain.
+func (s *Bolt) Height() (uint64, error) {
+	var height uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// Heights are big endian, so the last key is the highest.
+		if k, _ := tx.Bucket(heightsBucket).Cursor().Last(); k != nil {
+			height = binary.BigEndian.Uint64(k)
+		}
+		return nil
+	})
+	return height, err
+}
+
+// LoadAddrs returns the entries of the address book.
+func (s *Bolt) LoadAddrs() ([]addrbook.Entry, error) {
+	var entries []addrbook.Entry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(addrsBucket).ForEach(func(k, v []byte) error {
+			var e addrbook.Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("could not decode entry %s: %v", k, err)
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// SaveAddrs replaces the entries of the address book.
+func (s *Bolt) SaveAddrs(entries []addrbook.Entry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := recreateBucket(tx, addrsBucket)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := putJSON(b, []byte(e.Addr), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadBans returns the bans.
+func (s *Bolt) LoadBans() ([]addrbook.Ban, error) {
+	var bans []addrbook.Ban
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bansBucket).ForEach(func(k, v []byte) error {
+			var b addrbook.Ban
+			if err := json.Unmarshal(v, &b); err != nil {
+				return fmt.Errorf("could not decode ban %s: %v", k, err)
+			}
+			bans = append(bans, b)
+			return nil
+		})
+	})
+	return bans, err
+}
+
+// SaveBans replaces the bans.
+func (s *Bolt) SaveBans(bans []addrbook.Ban) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := recreateBucket(tx, bansBucket)
+		if err != nil {
+			return err
+		}
+		for _, ban := range bans {
+			if err := putJSON(b, []byte(ban.IP), ban); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Update applies the writes made by f in one transaction.
+func (s *Bolt) Update(f func(b Batch) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return f(boltBatch{tx})
+	})
+}
+
+// boltBatch is a batch of writes in a transaction.
+type boltBatch struct {
+	tx *bolt.Tx
+}
+
+// PutHeader stores the header under its hash.
+func (b boltBatch) PutHeader(h *message.BlockHeader) error {
+	var buf bytes.Buffer
+	if err := h.Write(&buf); err != nil {
+		return fmt.Errorf("could not encode header: %v", err)
+	}
+	hash := h.Hash()
+	return b.tx.Bucket(headersBucket).Put(hash[:], buf.Bytes())
+}
+
+// PutBlock stores the block under its hash.
+func (b boltBatch) PutBlock(block *message.Block) error {
+	var buf bytes.Buffer
+	if err := block.Write(&buf); err != nil {
+		return fmt.Errorf("could not encode block: %v", err)
+	}
+	hash := block.Hash()
+	return b.tx.Bucket(blocksBucket).Put(hash[:], buf.Bytes())
+}
+
+// SetHashAt sets the hash of the block at the height on the best chain.
+func (b boltBatch) SetHashAt(height uint64, hash message.Hash) error {
+	return b.tx.Bucket(heightsBucket).Put(encodeUint64(height), hash[:])
+}
+
+// Truncate removes the blocks above the height from the best chain.
+func (b boltBatch) Truncate(height uint64) error {
+	bucket := b.tx.Bucket(heightsBucket)
+	// Deleting while iterating with a cursor skips keys, so collect them first.
+	var keys [][]byte
+	c := bucket.Cursor()
+	for k, _ := c.Seek(encodeUint64(height + 1)); k != nil; k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recreateBucket empties the bucket.
+func recreateBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	if err := tx.DeleteBucket(name); err != nil {
+		return nil, fmt.Errorf("could not delete bucket %s: %v", name, err)
+	}
+	return tx.CreateBucket(name)
+}
+
+// putJSON stores the value encoded as JSON under the key.
+func putJSON(b *bolt.Bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %v", key, err)
+	}
+	return b.Put(key, data)
+}
+
+// encodeUint64 returns the big endian encoding of the value, which sorts like the value.
+func encodeUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/addrbook"
+	"github.com/zkirill/gringo/message"
+	bolt "go.etcd.io/bbolt"
+)
+
+// testHeader returns a header at the height.
+func testHeader(height uint64) message.BlockHeader {
+	return message.BlockHeader{
+		Version:         1,
+		Height:          height,
+		Timestamp:       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(height) * time.Minute),
+		TotalDifficulty: height + 1,
+		ProofOfWork:     message.Proof{Nonces: make([]uint32, message.ProofSize)},
+	}
+}
+
+func TestBolt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gringo.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := []message.BlockHeader{testHeader(1), testHeader(2), testHeader(3)}
+	block := &message.Block{Header: headers[0]}
+	err = s.Update(func(b Batch) error {
+		for i := range headers {
+			if err := b.PutHeader(&headers[i]); err != nil {
+				return err
+			}
+			if err := b.SetHashAt(headers[i].Height, headers[i].Hash()); err != nil {
+				return err
+			}
+		}
+		return b.PutBlock(block)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A failed batch writes nothing.
+	failed := errors.New("failed")
+	err = s.Update(func(b Batch) error {
+		if err := b.Truncate(1); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if err := s.SaveAddrs([]addrbook.Entry{{Addr: "10.0.0.1:13414", Successes: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveBans([]addrbook.Ban{{IP: "10.0.0.2", Reason: "bad magic"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Everything is there after reopening.
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if height, err := s.Height(); err != nil || height != 3 {
+		t.Errorf("wrong height: %v, %v", height, err)
+	}
+	if hash, err := s.HashAt(2); err != nil || hash != headers[1].Hash() {
+		t.Errorf("wrong hash at height 2: %v, %v", hash, err)
+	}
+	if h, err := s.Header(headers[2].Hash()); err != nil || h.Hash() != headers[2].Hash() {
+		t.Errorf("wrong header: %v, %v", h.Hash(), err)
+	}
+	n := 0
+	if err := s.ForEachHeader(func(*message.BlockHeader) error { n++; return nil }); err != nil || n != 3 {
+		t.Errorf("wrong number of headers: %v, %v", n, err)
+	}
+	if b, err := s.Block(block.Hash()); err != nil || b.Hash() != block.Hash() {
+		t.Errorf("wrong block: %v", err)
+	}
+	if ok, err := s.HasBlock(headers[1].Hash()); err != nil || ok {
+		t.Errorf("unexpected block: %v", err)
+	}
+	if _, err := s.Header(message.Hash{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("wrong error: %v", err)
+	}
+	if entries, err := s.LoadAddrs(); err != nil || len(entries) != 1 || entries[0].Successes != 1 {
+		t.Errorf("wrong addrs: %v, %v", entries, err)
+	}
+	if bans, err := s.LoadBans(); err != nil || len(bans) != 1 || bans[0].Reason != "bad magic" {
+		t.Errorf("wrong bans: %v, %v", bans, err)
+	}
+	// Truncate the best chain.
+	if err := s.Update(func(b Batch) error { return b.Truncate(1) }); err != nil {
+		t.Fatal(err)
+	}
+	if height, err := s.Height(); err != nil || height != 1 {
+		t.Errorf("wrong height after truncate: %v, %v", height, err)
+	}
+}
+
+func TestBoltSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gringo.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(versionKey, encodeUint64(SchemaVersion+1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := Open(path); !errors.Is(err, ErrSchemaVersion) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrSchemaVersion, err)
+	}
+}
@@ -0,0 +1,55 @@
+// Package store keeps the state of the node between runs.
+package store
+
+import (
+	"errors"
+
+	"github.com/zkirill/gringo/addrbook"
+	"github.com/zkirill/gringo/message"
+)
+
+// SchemaVersion is the version of the layout of the stored data.
+// It changes whenever stored data can no longer be read by older versions.
+const SchemaVersion = 1
+
+var (
+	// ErrNotFound is returned when the requested value is not stored.
+	ErrNotFound = errors.New("not found")
+	// ErrSchemaVersion is returned when opening a store written with another schema version.
+	ErrSchemaVersion = errors.New("unsupported schema version")
+)
+
+// Store holds headers, blocks, the index of the best chain by height, the address book and the ban list.
+// Implementations are safe for concurrent use.
+type Store interface {
+	addrbook.Storage
+	addrbook.BanStorage
+	// Header returns the header with the hash.
+	Header(hash message.Hash) (message.BlockHeader, error)
+	// ForEachHeader calls f with every stored header in no particular order.
+	ForEachHeader(f func(h *message.BlockHeader) error) error
+	// Block returns the block with the hash.
+	Block(hash message.Hash) (*message.Block, error)
+	// HasBlock returns true if the block with the hash is stored.
+	HasBlock(hash message.Hash) (bool, error)
+	// HashAt returns the hash of the block at the height on the best chain.
+	HashAt(height uint64) (message.Hash, error)
+	// Height returns the height of the best chain, or zero if the index is empty.
+	Height() (uint64, error)
+	// Update applies the writes made by f atomically. Nothing is written if f returns an error.
+	Update(f func(b Batch) error) error
+	// Close closes the store.
+	Close() error
+}
+
+// Batch is a set of writes applied together.
+type Batch interface {
+	// PutHeader stores the header under its hash.
+	PutHeader(h *message.BlockHeader) error
+	// PutBlock stores the block under its hash.
+	PutBlock(b *message.Block) error
+	// SetHashAt sets the hash of the block at the height on the best chain.
+	SetHashAt(height uint64, hash message.Hash) error
+	// Truncate removes the blocks above the height from the best chain.
+	Truncate(height uint64) error
+}
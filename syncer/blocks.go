@@ -0,0 +1,307 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zkirill/gringo/chain"
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/peer"
+	"github.com/zkirill/gringo/validation"
+)
+
+const (
+	// DefaultWindow is the number of blocks past the last delivered one that may be requested when none is configured.
+	DefaultWindow = 64
+	// DefaultPerPeer is the number of blocks that may be requested from one peer at a time when none is configured.
+	DefaultPerPeer = 8
+)
+
+// BlockConfig configures a block downloader.
+type BlockConfig struct {
+	// Chain is our chain of headers. Blocks are downloaded up to its head.
+	Chain *chain.Chain
+	// Peers returns the connected peers.
+	Peers func() []*peer.Peer
+	// Deliver is called with every valid block in height order.
+	// If it returns an error the block is requested again. The peer that sent the block is only penalised
+	// if the error is a *validation.Error.
+	Deliver func(b *message.Block) error
+	// Start is the height of the first block to download.
+	Start uint64
+	// Window is the number of blocks past the last delivered one that may be requested.
+	Window int
+	// PerPeer is the number of blocks that may be requested from one peer at a time.
+	PerPeer int
+	// Interval is how often requests are checked.
+	Interval time.Duration
+	// Timeout is how long a peer has to send a block before it is requested from another peer.
+	Timeout time.Duration
+}
+
+// blockRequest is a request for the block at a height.
+type blockRequest struct {
+	hash message.Hash
+	peer *peer.Peer
+	sent time.Time
+}
+
+// received is a block waiting for the blocks below it.
+type received struct {
+	block *message.Block
+	peer  *peer.Peer
+}
+
+// BlockDownloader downloads the blocks of our chain of headers from several peers in parallel.
+// Only blocks within a window above the last delivered one are requested, so a slow peer cannot make the
+// downloader buffer an unbounded number of blocks. Requests that time out are sent to another peer.
+type BlockDownloader struct {
+	c BlockConfig
+
+	// deliverMu makes the blocks delivered one at a time, in height order.
+	deliverMu sync.Mutex
+	mu        sync.Mutex
+	// next is the height of the next block to deliver.
+	next uint64
+	// pending are the requests by height.
+	pending map[uint64]*blockRequest
+	// received are the blocks that arrived out of order by height.
+	received map[uint64]received
+	// timedOut are the peers that did not send the block at a height in time.
+	timedOut map[uint64]*peer.Peer
+	// delivering is the height of the block being delivered, or zero if none is
+	// or if a reorg took it off our chain.
+	delivering uint64
+	// wake is signalled when more blocks can be requested.
+	wake chan struct{}
+}
+
+// NewBlockDownloader returns a new block downloader. Zero values in the config are replaced with defaults.
+func NewBlockDownloader(c BlockConfig) *BlockDownloader {
+	if c.Start == 0 {
+		// The genesis block is part of the chain.
+		c.Start = 1
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultWindow
+	}
+	if c.PerPeer <= 0 {
+		c.PerPeer = DefaultPerPeer
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	return &BlockDownloader{
+		c:        c,
+		next:     c.Start,
+		pending:  make(map[uint64]*blockRequest),
+		received: make(map[uint64]received),
+		timedOut: make(map[uint64]*peer.Peer),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Run downloads blocks until the context is cancelled.
+func (d *BlockDownloader) Run(ctx context.Context) error {
+	t := time.NewTicker(d.c.Interval)
+	defer t.Stop()
+	for {
+		d.step()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Height returns the height of the last delivered block.
+func (d *BlockDownloader) Height() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.next - 1
+}
+
+// Handle handles the blocks that we requested. Other messages are ignored.
+func (d *BlockDownloader) Handle(p *peer.Peer, m message.Message) {
+	b, ok := m.(*message.Block)
+	if !ok {
+		return
+	}
+	height := b.Header.Height
+	d.mu.Lock()
+	r, ok := d.pending[height]
+	if !ok || r.hash != b.Hash() {
+		// Unsolicited, too late or not on our chain.
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, height)
+	if err := validation.ValidateBlock(b); err != nil {
+		// Ask another peer.
+		d.timedOut[height] = p
+		d.mu.Unlock()
+		glog.Warningf("invalid block from %v: %v", p, err)
+		p.Misbehave(peer.InvalidBlock)
+		return
+	}
+	delete(d.timedOut, height)
+	d.received[height] = received{block: b, peer: p}
+	d.mu.Unlock()
+	d.deliver()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Reorg forgets the blocks of the old branch, so that the blocks of the new one are downloaded
+// and delivered from the common ancestor on.
+func (d *BlockDownloader) Reorg(r chain.Reorg) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for height := range d.pending {
+		if height > r.Ancestor.Height {
+			delete(d.pending, height)
+		}
+	}
+	for height := range d.received {
+		if height > r.Ancestor.Height {
+			delete(d.received, height)
+		}
+	}
+	for height := range d.timedOut {
+		if height > r.Ancestor.Height {
+			delete(d.timedOut, height)
+		}
+	}
+	if d.delivering > r.Ancestor.Height {
+		d.delivering = 0
+	}
+	if d.next > r.Ancestor.Height+1 {
+		d.next = r.Ancestor.Height + 1
+	}
+}
+
+// deliver delivers the received blocks that are next in height order.
+// Delivering may be slow, so mu is only held between the blocks.
+func (d *BlockDownloader) deliver() {
+	d.deliverMu.Lock()
+	defer d.deliverMu.Unlock()
+	for {
+		d.mu.Lock()
+		height := d.next
+		r, ok := d.received[height]
+		if !ok {
+			d.mu.Unlock()
+			return
+		}
+		delete(d.received, height)
+		d.delivering = height
+		d.mu.Unlock()
+		err := d.c.Deliver(r.block)
+		d.mu.Lock()
+		// A reorg during the delivery leaves the height to the blocks of the new branch.
+		delivered := err == nil && d.delivering == height
+		if delivered {
+			d.next++
+		}
+		d.delivering = 0
+		d.mu.Unlock()
+		if err != nil {
+			// The block will be requested again. Only the peer is to blame if the block is invalid.
+			glog.Warningf("could not deliver block %v at height %v from %v: %v", r.block.Hash(), height, r.peer, err)
+			var invalid *validation.Error
+			if errors.As(err, &invalid) {
+				r.peer.Misbehave(peer.InvalidBlock)
+			}
+			return
+		}
+		if !delivered {
+			return
+		}
+	}
+}
+
+// step reassigns the requests that timed out and requests the missing blocks in the window.
+func (d *BlockDownloader) step() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	load := make(map[*peer.Peer]int)
+	for height, r := range d.pending {
+		if now.Sub(r.sent) >= d.c.Timeout || r.peer.Err() != nil {
+			glog.Warningf("no block at height %v from %v", height, r.peer)
+			delete(d.pending, height)
+			d.timedOut[height] = r.peer
+			continue
+		}
+		load[r.peer]++
+	}
+	peers := d.c.Peers()
+	end := d.next + uint64(d.c.Window)
+	if head := d.c.Chain.Height(); end > head+1 {
+		end = head + 1
+	}
+	for height := d.next; height < end; height++ {
+		if _, ok := d.pending[height]; ok {
+			continue
+		}
+		if _, ok := d.received[height]; ok {
+			continue
+		}
+		header, err := d.c.Chain.HeaderAt(height)
+		if err != nil {
+			glog.Errorf("could not get header at height %v: %v", height, err)
+			return
+		}
+		hash, err := d.c.Chain.HashAt(height)
+		if err != nil {
+			glog.Errorf("could not get hash at height %v: %v", height, err)
+			return
+		}
+		for {
+			p := d.pick(peers, load, header.TotalDifficulty, d.timedOut[height])
+			if p == nil {
+				// Every peer is busy.
+				return
+			}
+			if err := p.Send(&message.GetBlock{Hash: hash}); err != nil {
+				glog.Warningf("could not request block from %v: %v", p, err)
+				// Do not pick the peer again in this step.
+				load[p] = d.c.PerPeer
+				continue
+			}
+			d.pending[height] = &blockRequest{hash: hash, peer: p, sent: now}
+			load[p]++
+			break
+		}
+	}
+}
+
+// pick returns the least loaded open peer that has the block with the total difficulty.
+// The peer that timed out on the block is only picked if there is no other.
+func (d *BlockDownloader) pick(peers []*peer.Peer, load map[*peer.Peer]int, totalDifficulty uint64, avoid *peer.Peer) *peer.Peer {
+	var best *peer.Peer
+	for _, p := range peers {
+		if p.Err() != nil || load[p] >= d.c.PerPeer || p.TotalDifficulty() < totalDifficulty {
+			continue
+		}
+		switch {
+		case best == nil:
+			best = p
+		case best == avoid && p != avoid:
+			best = p
+		case p != avoid && load[p] < load[best]:
+			best = p
+		}
+	}
+	return best
+}
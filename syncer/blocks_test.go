@@ -0,0 +1,154 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/chain"
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/peer"
+)
+
+// testBlock returns a block with the header and only a coinbase.
+func testBlock(h message.BlockHeader) *message.Block {
+	return &message.Block{
+		Header:  h,
+		Outputs: []message.Output{{Features: message.CoinbaseOutputFeatures}},
+		Kernels: []message.TxKernel{{Features: message.CoinbaseKernelFeatures}},
+	}
+}
+
+func TestBlockDownloader(t *testing.T) {
+	remote, _ := testChain(t, 40)
+	var mu sync.Mutex
+	var delivered []uint64
+	var behind []uint64
+	var d *BlockDownloader
+	handler := func(p *peer.Peer, m message.Message) { d.Handle(p, m) }
+	// The first peer never sends the blocks at odd heights.
+	silent := []func(uint64) bool{
+		func(h uint64) bool { return h%2 == 1 },
+		func(uint64) bool { return false },
+	}
+	var peers []*peer.Peer
+	for _, s := range silent {
+		a, b := net.Pipe()
+		defer b.Close()
+		go serve(b, remote, 0, s)
+		p := peer.New(a, &handshake.PeerInfo{TotalDifficulty: remote.TotalDifficulty()}, handler)
+		p.Start(context.Background())
+		defer p.Close()
+		peers = append(peers, p)
+	}
+	d = NewBlockDownloader(BlockConfig{
+		Chain: remote,
+		Peers: func() []*peer.Peer { return peers },
+		Deliver: func(b *message.Block) error {
+			// The downloader is not locked while a block is delivered.
+			height := d.Height()
+			mu.Lock()
+			defer mu.Unlock()
+			if height != b.Header.Height-1 {
+				behind = append(behind, height)
+			}
+			delivered = append(delivered, b.Header.Height)
+			return nil
+		},
+		Window:   10,
+		PerPeer:  3,
+		Interval: 10 * time.Millisecond,
+		Timeout:  50 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for d.Height() != 40 {
+		if time.Now().After(deadline) {
+			t.Fatalf("not downloaded: height %v", d.Height())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, h := range delivered {
+		if h != uint64(i+1) {
+			t.Fatalf("blocks delivered out of order: %v", delivered)
+		}
+	}
+	if len(behind) != 0 {
+		t.Errorf("wrong heights during delivery: %v", behind)
+	}
+}
+
+func TestBlockDownloaderReorg(t *testing.T) {
+	remote, _ := testChain(t, 10)
+	d := NewBlockDownloader(BlockConfig{Chain: remote, Peers: func() []*peer.Peer { return nil }})
+	d.next = 8
+	d.pending[9] = &blockRequest{}
+	d.received[5] = received{}
+	d.timedOut[6] = &peer.Peer{}
+	d.timedOut[3] = &peer.Peer{}
+	d.delivering = 7
+	d.Reorg(chain.Reorg{Ancestor: chain.BlockID{Height: 4}})
+	if d.Height() != 4 || len(d.pending) != 0 || len(d.received) != 0 || d.delivering != 0 {
+		t.Errorf("old branch not forgotten: height %v, %v pending, %v received, delivering %v", d.Height(), len(d.pending), len(d.received), d.delivering)
+	}
+	// The peers that timed out on the old branch may have the blocks of the new one.
+	if _, ok := d.timedOut[6]; ok || len(d.timedOut) != 1 {
+		t.Errorf("wrong timed out heights: %v", d.timedOut)
+	}
+}
+
+func TestBlockDownloaderReorgDuringDelivery(t *testing.T) {
+	remote, _ := testChain(t, 2)
+	var d *BlockDownloader
+	d = NewBlockDownloader(BlockConfig{
+		Chain: remote,
+		Peers: func() []*peer.Peer { return nil },
+		Deliver: func(b *message.Block) error {
+			// The block is taken off our chain while it is delivered.
+			d.Reorg(chain.Reorg{Ancestor: chain.BlockID{Height: 0}})
+			return nil
+		},
+	})
+	header, _ := remote.HeaderAt(1)
+	d.pending[1] = &blockRequest{hash: header.Hash(), sent: time.Now()}
+	d.Handle(nil, testBlock(header))
+	if d.Height() != 0 {
+		t.Errorf("block of the old branch counted as delivered: height %v", d.Height())
+	}
+}
+
+func TestBlockDownloaderInvalid(t *testing.T) {
+	remote, _ := testChain(t, 2)
+	d := NewBlockDownloader(BlockConfig{
+		Chain:   remote,
+		Peers:   func() []*peer.Peer { return nil },
+		Deliver: func(b *message.Block) error { return errors.New("disk full") },
+	})
+	a, b := net.Pipe()
+	defer b.Close()
+	p := peer.New(a, &handshake.PeerInfo{}, nil)
+	header, _ := remote.HeaderAt(1)
+	// A block that fails to be stored is not the fault of the peer.
+	d.pending[1] = &blockRequest{hash: header.Hash(), peer: p, sent: time.Now()}
+	d.Handle(p, testBlock(header))
+	if p.Score() != 0 || d.Height() != 0 {
+		t.Errorf("wrong score %v or height %v after storage error", p.Score(), d.Height())
+	}
+	// A block without a coinbase is.
+	d.pending[1] = &blockRequest{hash: header.Hash(), peer: p, sent: time.Now()}
+	d.Handle(p, &message.Block{Header: header})
+	if p.Score() != peer.InvalidBlock.Penalty() || d.Height() != 0 {
+		t.Errorf("wrong score %v or height %v after invalid block", p.Score(), d.Height())
+	}
+	if d.timedOut[1] != p {
+		t.Error("invalid block will be requested from the same peer")
+	}
+}
@@ -0,0 +1,251 @@
+// Package syncer keeps the local chain in sync with the peers.
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zkirill/gringo/chain"
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/peer"
+	"github.com/zkirill/gringo/validation"
+)
+
+const (
+	// DefaultInterval is how often the sync state is checked when no interval is configured.
+	DefaultInterval = 5 * time.Second
+	// DefaultTimeout is how long a peer has to answer a request when no timeout is configured.
+	DefaultTimeout = 30 * time.Second
+	// StallTime is how long a peer that did not deliver the headers it advertised is not synced from.
+	StallTime = 10 * time.Minute
+)
+
+// State is the state of the header sync.
+type State int
+
+const (
+	// StateIdle means that there is no peer to sync from.
+	StateIdle State = iota
+	// StateHeaders means that headers are being downloaded from the peer with the most total difficulty.
+	StateHeaders
+	// StateSynced means that no peer has more total difficulty than our chain.
+	StateSynced
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateHeaders:
+		return "syncing headers"
+	case StateSynced:
+		return "synced"
+	}
+	return fmt.Sprintf("state %d", int(s))
+}
+
+// Progress is the progress of the header sync.
+type Progress struct {
+	// State is the state of the sync.
+	State State
+	// Height is the height of our chain.
+	Height uint64
+	// TargetHeight is the height advertised by the peer we sync from, if known.
+	TargetHeight uint64
+	// HeadersPerSec is the rate at which headers were added since the sync started.
+	HeadersPerSec float64
+}
+
+// Config configures a header sync.
+type Config struct {
+	// Chain is our chain.
+	Chain *chain.Chain
+	// Peers returns the connected peers.
+	Peers func() []*peer.Peer
+	// Interval is how often the sync state is checked.
+	Interval time.Duration
+	// Timeout is how long a peer has to answer a request.
+	Timeout time.Duration
+}
+
+// HeaderSync downloads headers from the peer with the most total difficulty until our chain catches up.
+// Headers are requested with a locator built from our chain, so each batch continues where the last one ended.
+type HeaderSync struct {
+	c Config
+
+	mu    sync.Mutex
+	state State
+	// peer is the peer asked for headers, or nil if no request is pending.
+	peer *peer.Peer
+	// requested is when the pending request was sent.
+	requested time.Time
+	// target is the height advertised by the peer we sync from.
+	target uint64
+	// stalled are the peers that timed out or sent no new headers, with when they did.
+	stalled map[*peer.Peer]time.Time
+	// started and startHeight are when and from which height the sync started.
+	started     time.Time
+	startHeight uint64
+	// wake is signalled when the next batch can be requested.
+	wake chan struct{}
+}
+
+// NewHeaderSync returns a new header sync. Zero values in the config are replaced with defaults.
+func NewHeaderSync(c Config) *HeaderSync {
+	if c.Interval <= 0 {
+		c.Interval = DefaultInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+	return &HeaderSync{
+		c:       c,
+		stalled: make(map[*peer.Peer]time.Time),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Run syncs headers until the context is cancelled.
+func (s *HeaderSync) Run(ctx context.Context) error {
+	t := time.NewTicker(s.c.Interval)
+	defer t.Stop()
+	for {
+		s.step()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// Handle handles the headers that we requested. Other messages are ignored.
+func (s *HeaderSync) Handle(p *peer.Peer, m message.Message) {
+	v, ok := m.(*message.BlockHeaders)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	if s.peer != p {
+		// Unsolicited or too late.
+		s.mu.Unlock()
+		return
+	}
+	s.peer = nil
+	s.mu.Unlock()
+	n, err := s.c.Chain.AddHeaders(v.Headers)
+	if err != nil {
+		var invalid *validation.Error
+		if errors.As(err, &invalid) {
+			p.Misbehave(peer.InvalidHeader)
+		}
+		glog.Warningf("could not add headers from %v: %v", p, err)
+	}
+	if n == 0 && p.TotalDifficulty() > s.c.Chain.TotalDifficulty() {
+		// The peer advertises more than it delivers.
+		glog.Warningf("no new headers from %v", p)
+		s.mu.Lock()
+		s.stalled[p] = time.Now()
+		s.mu.Unlock()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	if n > 0 {
+		pr := s.Progress()
+		glog.Infof("header sync: height %v of %v, %.1f headers/s", pr.Height, pr.TargetHeight, pr.HeadersPerSec)
+		// Ask for the next batch right away.
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Progress returns the progress of the sync.
+func (s *HeaderSync) Progress() Progress {
+	height := s.c.Chain.Height()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pr := Progress{State: s.state, Height: height, TargetHeight: s.target}
+	if pr.TargetHeight < height {
+		pr.TargetHeight = height
+	}
+	if elapsed := time.Since(s.started).Seconds(); s.state != StateIdle && elapsed > 0 && height > s.startHeight {
+		pr.HeadersPerSec = float64(height-s.startHeight) / elapsed
+	}
+	return pr
+}
+
+// step requests headers from the best peer unless a request is pending or our chain has caught up.
+func (s *HeaderSync) step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peer != nil {
+		if time.Since(s.requested) < s.c.Timeout && s.peer.Err() == nil {
+			return
+		}
+		glog.Warningf("no headers from %v", s.peer)
+		s.stalled[s.peer] = time.Now()
+		s.peer = nil
+	}
+	best := s.best()
+	if best == nil {
+		s.state = StateIdle
+		return
+	}
+	if best.TotalDifficulty() <= s.c.Chain.TotalDifficulty() {
+		if s.state == StateHeaders {
+			glog.Infof("header sync: caught up at height %v", s.c.Chain.Height())
+		}
+		s.state = StateSynced
+		return
+	}
+	if s.state != StateHeaders {
+		s.state = StateHeaders
+		s.started = time.Now()
+		s.startHeight = s.c.Chain.Height()
+		glog.Infof("header sync: started from height %v with %v", s.startHeight, best)
+	}
+	l, err := s.c.Chain.Locator()
+	if err != nil {
+		glog.Errorf("could not build locator: %v", err)
+		return
+	}
+	if err := best.Send(&message.GetHeaders{Locator: l}); err != nil {
+		glog.Warningf("could not request headers from %v: %v", best, err)
+		return
+	}
+	s.peer = best
+	s.requested = time.Now()
+	s.target = best.Height()
+}
+
+// best returns the open peer with the most total difficulty that has not stalled recently, or nil if there is none.
+// The caller must hold mu.
+func (s *HeaderSync) best() *peer.Peer {
+	for p, t := range s.stalled {
+		if p.Err() != nil || time.Since(t) >= StallTime {
+			delete(s.stalled, p)
+		}
+	}
+	var best *peer.Peer
+	for _, p := range s.c.Peers() {
+		if p.Err() != nil {
+			continue
+		}
+		if _, ok := s.stalled[p]; ok {
+			continue
+		}
+		if best == nil || p.TotalDifficulty() > best.TotalDifficulty() {
+			best = p
+		}
+	}
+	return best
+}
@@ -0,0 +1,155 @@
+package syncer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/chain"
+	"github.com/zkirill/gringo/handshake"
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/peer"
+)
+
+// testChain returns a chain of the height and the genesis it starts from.
+func testChain(t *testing.T, height int) (*chain.Chain, message.BlockHeader) {
+	genesis := message.BlockHeader{
+		Version:         1,
+		Timestamp:       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		TotalDifficulty: 1,
+		ProofOfWork:     message.Proof{Nonces: make([]uint32, message.ProofSize)},
+	}
+	c := chain.New(genesis, genesis.Hash())
+	headers := make([]message.BlockHeader, height)
+	parent := genesis
+	for i := range headers {
+		h := parent
+		h.Height++
+		h.Previous = parent.Hash()
+		h.Timestamp = parent.Timestamp.Add(time.Minute)
+		h.TotalDifficulty += 10
+		headers[i] = h
+		parent = h
+	}
+	if _, err := c.AddHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+	return c, genesis
+}
+
+// serve answers requests for headers and blocks on the connection from the chain.
+// Headers are sent batch at a time. Requests for blocks at heights for which silent returns true are not answered.
+func serve(conn net.Conn, c *chain.Chain, batch int, silent func(height uint64) bool) {
+	for {
+		m, err := message.ReadMessage(conn)
+		if err != nil {
+			return
+		}
+		if req, ok := m.(*message.GetBlock); ok {
+			for h := uint64(0); h <= c.Height(); h++ {
+				if got, _ := c.HashAt(h); got == req.Hash && (silent == nil || !silent(h)) {
+					header, _ := c.HeaderAt(h)
+					if err := message.WriteMessage(conn, testBlock(header)); err != nil {
+						return
+					}
+				}
+			}
+			continue
+		}
+		req, ok := m.(*message.GetHeaders)
+		if !ok {
+			continue
+		}
+		// Find the most recent header that we share.
+		var from uint64
+		for _, hash := range req.Locator.Hashes {
+			if c.Has(hash) {
+				for h := uint64(0); h <= c.Height(); h++ {
+					if got, _ := c.HashAt(h); got == hash {
+						from = h
+					}
+				}
+				break
+			}
+		}
+		var r message.BlockHeaders
+		for h := from + 1; h <= c.Height() && len(r.Headers) < batch; h++ {
+			header, _ := c.HeaderAt(h)
+			r.Headers = append(r.Headers, header)
+		}
+		if err := message.WriteMessage(conn, &r); err != nil {
+			return
+		}
+	}
+}
+
+func TestHeaderSync(t *testing.T) {
+	remote, genesis := testChain(t, 50)
+	local := chain.New(genesis, genesis.Hash())
+	a, b := net.Pipe()
+	defer b.Close()
+	go serve(b, remote, 7, nil)
+	var s *HeaderSync
+	p := peer.New(a, &handshake.PeerInfo{TotalDifficulty: remote.TotalDifficulty()}, func(p *peer.Peer, m message.Message) {
+		s.Handle(p, m)
+	})
+	s = NewHeaderSync(Config{
+		Chain:    local,
+		Peers:    func() []*peer.Peer { return []*peer.Peer{p} },
+		Interval: 10 * time.Millisecond,
+	})
+	p.Start(context.Background())
+	defer p.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Progress().State != StateSynced {
+		if time.Now().After(deadline) {
+			t.Fatalf("not synced: %+v", s.Progress())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, want := remote.Head()
+	if _, got := local.Head(); got != want || local.Height() != 50 {
+		t.Errorf("wrong head at height %v: expecting %v, got %v", local.Height(), want, got)
+	}
+}
+
+func TestHeaderSyncStalled(t *testing.T) {
+	remote, genesis := testChain(t, 50)
+	local := chain.New(genesis, genesis.Hash())
+	var s *HeaderSync
+	handler := func(p *peer.Peer, m message.Message) {
+		s.Handle(p, m)
+	}
+	// The liar claims much more difficulty than the honest peer but only has the genesis.
+	a, b := net.Pipe()
+	defer b.Close()
+	go serve(b, chain.New(genesis, genesis.Hash()), 7, nil)
+	liar := peer.New(a, &handshake.PeerInfo{TotalDifficulty: 1 << 40}, handler)
+	c, d := net.Pipe()
+	defer d.Close()
+	go serve(d, remote, 7, nil)
+	honest := peer.New(c, &handshake.PeerInfo{TotalDifficulty: remote.TotalDifficulty()}, handler)
+	s = NewHeaderSync(Config{
+		Chain:    local,
+		Peers:    func() []*peer.Peer { return []*peer.Peer{liar, honest} },
+		Interval: 10 * time.Millisecond,
+	})
+	for _, p := range []*peer.Peer{liar, honest} {
+		p.Start(context.Background())
+		defer p.Close()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for local.Height() != remote.Height() || s.Progress().State != StateSynced {
+		if time.Now().After(deadline) {
+			t.Fatalf("not synced from the honest peer: %+v", s.Progress())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
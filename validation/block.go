@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zkirill/gringo/message"
+)
+
+var (
+	// ErrNoCoinbase is returned when a block has no coinbase output or no coinbase kernel.
+	ErrNoCoinbase = errors.New("no coinbase")
+	// ErrCoinbaseFee is returned when a coinbase kernel pays a fee.
+	ErrCoinbaseFee = errors.New("coinbase kernel with fee")
+	// ErrDuplicateCommitment is returned when a block has two inputs, outputs or kernels with the same commitment.
+	ErrDuplicateCommitment = errors.New("duplicate commitment")
+	// ErrCutThrough is returned when a block spends an output that it creates.
+	ErrCutThrough = errors.New("output spent in the same block")
+	// ErrLockHeight is returned when a kernel is locked until after the height of its block.
+	ErrLockHeight = errors.New("kernel locked")
+)
+
+// ValidateBlock checks the body of the block against its header.
+// The proofs and signatures are not verified. The error is an *Error if the block breaks a rule.
+func ValidateBlock(b *message.Block) error {
+	if err := validateBlock(b); err != nil {
+		return &Error{Hash: b.Hash(), Height: b.Header.Height, Err: err}
+	}
+	return nil
+}
+
+// validateBlock returns the rule that the block breaks.
+func validateBlock(b *message.Block) error {
+	type commitment = [message.CommitmentSize]uint8
+	inputs := make(map[commitment]struct{}, len(b.Inputs))
+	for _, in := range b.Inputs {
+		if _, ok := inputs[in.Commit]; ok {
+			return fmt.Errorf("%w: input %x", ErrDuplicateCommitment, in.Commit)
+		}
+		inputs[in.Commit] = struct{}{}
+	}
+	outputs := make(map[commitment]struct{}, len(b.Outputs))
+	coinbase := false
+	for _, out := range b.Outputs {
+		if _, ok := outputs[out.Commit]; ok {
+			return fmt.Errorf("%w: output %x", ErrDuplicateCommitment, out.Commit)
+		}
+		if _, ok := inputs[out.Commit]; ok {
+			return fmt.Errorf("%w: %x", ErrCutThrough, out.Commit)
+		}
+		outputs[out.Commit] = struct{}{}
+		coinbase = coinbase || out.Features&message.CoinbaseOutputFeatures != 0
+	}
+	if !coinbase {
+		return fmt.Errorf("%w output", ErrNoCoinbase)
+	}
+	excesses := make(map[commitment]struct{}, len(b.Kernels))
+	coinbase = false
+	for _, k := range b.Kernels {
+		if _, ok := excesses[k.Excess]; ok {
+			return fmt.Errorf("%w: kernel %x", ErrDuplicateCommitment, k.Excess)
+		}
+		excesses[k.Excess] = struct{}{}
+		if k.LockHeight > b.Header.Height {
+			return fmt.Errorf("%w: until height %v", ErrLockHeight, k.LockHeight)
+		}
+		if k.Features&message.CoinbaseKernelFeatures != 0 {
+			if k.Fee != 0 {
+				return fmt.Errorf("%w: %v", ErrCoinbaseFee, k.Fee)
+			}
+			coinbase = true
+		}
+	}
+	if !coinbase {
+		return fmt.Errorf("%w kernel", ErrNoCoinbase)
+	}
+	return nil
+}
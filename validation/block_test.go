@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zkirill/gringo/message"
+)
+
+// testBlock returns a valid block at height 10 with a coinbase and one transaction.
+func testBlock() *message.Block {
+	b := &message.Block{Header: message.BlockHeader{Version: 1, Height: 10}}
+	b.Inputs = []message.Input{{Commit: [message.CommitmentSize]uint8{1}}}
+	b.Outputs = []message.Output{
+		{Features: message.CoinbaseOutputFeatures, Commit: [message.CommitmentSize]uint8{2}},
+		{Commit: [message.CommitmentSize]uint8{3}},
+	}
+	b.Kernels = []message.TxKernel{
+		{Features: message.CoinbaseKernelFeatures, Excess: [message.CommitmentSize]uint8{4}},
+		{Fee: 8, LockHeight: 10, Excess: [message.CommitmentSize]uint8{5}},
+	}
+	return b
+}
+
+func TestValidateBlock(t *testing.T) {
+	if err := ValidateBlock(testBlock()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func(b *message.Block)
+		err    error
+	}{
+		{"no coinbase output", func(b *message.Block) { b.Outputs = b.Outputs[1:] }, ErrNoCoinbase},
+		{"no coinbase kernel", func(b *message.Block) { b.Kernels = b.Kernels[1:] }, ErrNoCoinbase},
+		{"coinbase fee", func(b *message.Block) { b.Kernels[0].Fee = 1 }, ErrCoinbaseFee},
+		{"duplicate input", func(b *message.Block) { b.Inputs = append(b.Inputs, b.Inputs[0]) }, ErrDuplicateCommitment},
+		{"duplicate output", func(b *message.Block) { b.Outputs[1].Commit = b.Outputs[0].Commit }, ErrDuplicateCommitment},
+		{"duplicate kernel", func(b *message.Block) { b.Kernels[1].Excess = b.Kernels[0].Excess }, ErrDuplicateCommitment},
+		{"cut through", func(b *message.Block) { b.Inputs[0].Commit = b.Outputs[1].Commit }, ErrCutThrough},
+		{"lock height", func(b *message.Block) { b.Kernels[1].LockHeight = 11 }, ErrLockHeight},
+	}
+	for _, test := range tests {
+		b := testBlock()
+		test.modify(b)
+		err := ValidateBlock(b)
+		var invalid *Error
+		if !errors.Is(err, test.err) || !errors.As(err, &invalid) || invalid.Hash != b.Hash() {
+			t.Errorf("%v: wrong error: expecting %v, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/zkirill/gringo/message"
+)
+
+const (
+	// DifficultyAdjustWindow is the number of blocks whose difficulty and duration set the next difficulty.
+	DifficultyAdjustWindow = 23
+	// DampFactor is how much the duration of the window is damped towards the target before adjusting the difficulty.
+	DampFactor = 3
+)
+
+// sample is the timestamp in seconds and the difficulty of a header.
+type sample struct {
+	time       int64
+	difficulty uint64
+}
+
+// NextDifficulty returns the difficulty of the child of the parent, looking up the headers before it in headers.
+// The difficulty is adjusted to the time taken by the last DifficultyAdjustWindow blocks, measured between the
+// median timestamps of the MedianTimeSpan blocks at each end of the window.
+// Perfectly timed blocks of the initial difficulty are assumed before the genesis.
+func (r Rules) NextDifficulty(parent *message.BlockHeader, headers Headers) (uint64, error) {
+	samples, err := r.samples(parent, headers)
+	if err != nil {
+		return 0, err
+	}
+	median := func(s []sample) int64 {
+		times := make([]int64, len(s))
+		for i := range s {
+			times[i] = s[i].time
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		return times[len(times)/2]
+	}
+	delta := median(samples[DifficultyAdjustWindow:]) - median(samples[:MedianTimeSpan])
+	if delta < 0 {
+		delta = 0
+	}
+	sum := new(big.Int)
+	for _, s := range samples[MedianTimeSpan:] {
+		sum.Add(sum, new(big.Int).SetUint64(s.difficulty))
+	}
+	blockTime := int64(r.BlockTime.Seconds())
+	window := DifficultyAdjustWindow * blockTime
+	// Damp the time unless the difficulty is close to one.
+	if sum.Cmp(big.NewInt(DampFactor*DifficultyAdjustWindow)) >= 0 {
+		delta = (delta + (DampFactor-1)*window) / DampFactor
+	}
+	if lower := window * 5 / 6; delta < lower {
+		delta = lower
+	}
+	if upper := window * 4 / 3; delta > upper {
+		delta = upper
+	}
+	next := sum.Mul(sum, big.NewInt(blockTime))
+	next.Quo(next, big.NewInt(delta))
+	if !next.IsUint64() {
+		return 0, fmt.Errorf("%w: next difficulty %v too large", ErrDifficulty, next)
+	}
+	d := next.Uint64()
+	if d < r.minDifficulty() {
+		d = r.minDifficulty()
+	}
+	return d, nil
+}
+
+// samples returns the samples of the DifficultyAdjustWindow+MedianTimeSpan headers up to the parent, oldest first.
+func (r Rules) samples(parent *message.BlockHeader, headers Headers) ([]sample, error) {
+	const n = DifficultyAdjustWindow + MedianTimeSpan
+	samples := make([]sample, n)
+	i := n - 1
+	for h := *parent; i >= 0; i-- {
+		s := sample{time: h.Timestamp.Unix(), difficulty: h.TotalDifficulty}
+		if h.Height == 0 {
+			samples[i] = s
+			i--
+			break
+		}
+		prev, err := headers.Header(h.Previous)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ancestor %v at height %v", ErrUnknownParent, h.Previous, h.Height-1)
+		}
+		s.difficulty -= prev.TotalDifficulty
+		samples[i] = s
+		h = prev
+	}
+	// Pad with the blocks before the genesis.
+	difficulty := r.InitialDifficulty
+	if difficulty == 0 {
+		difficulty = samples[i+1].difficulty
+	}
+	for ; i >= 0; i-- {
+		samples[i] = sample{time: samples[i+1].time - int64(r.BlockTime.Seconds()), difficulty: difficulty}
+	}
+	return samples, nil
+}
@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+)
+
+// timedChain returns a chain of n headers of the difficulty, the interval apart, and its headers by hash.
+func timedChain(n int, difficulty uint64, interval time.Duration) ([]message.BlockHeader, testHeaders) {
+	chain := make([]message.BlockHeader, n)
+	headers := make(testHeaders)
+	for i := range chain {
+		h := message.BlockHeader{
+			Version:         1,
+			Height:          uint64(i),
+			Timestamp:       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * interval),
+			TotalDifficulty: uint64(i+1) * difficulty,
+		}
+		if i > 0 {
+			h.Previous = chain[i-1].Hash()
+		}
+		chain[i] = h
+		headers[h.Hash()] = h
+	}
+	return chain, headers
+}
+
+func TestNextDifficulty(t *testing.T) {
+	rules := Rules{MinDifficulty: 1, InitialDifficulty: 1000, BlockTime: time.Minute}
+	tests := []struct {
+		name     string
+		n        int
+		interval time.Duration
+		want     uint64
+	}{
+		{"genesis", 1, time.Minute, 1000},
+		{"on time", 50, time.Minute, 1000},
+		// Blocks twice as fast are damped to the lower bound of the window.
+		{"fast", 50, 30 * time.Second, 1200},
+		// Blocks three times as slow are damped and then bounded.
+		{"slow", 50, 3 * time.Minute, 750},
+		// Only part of the window is slow, the rest being assumed on time before the genesis.
+		{"slow start", 5, 3 * time.Minute, 1000},
+	}
+	for _, tt := range tests {
+		chain, headers := timedChain(tt.n, 1000, tt.interval)
+		got, err := rules.NextDifficulty(&chain[len(chain)-1], headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%v: wrong difficulty: expecting %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	// The difficulty does not go below the minimum.
+	chain, headers := timedChain(50, 1, time.Hour)
+	rules.MinDifficulty = 2
+	if got, err := rules.NextDifficulty(&chain[len(chain)-1], headers); err != nil || got != 2 {
+		t.Errorf("wrong difficulty below minimum: %v, %v", got, err)
+	}
+}
+
+func TestValidateDifficulty(t *testing.T) {
+	rules := Rules{MinDifficulty: 1, InitialDifficulty: 1000, BlockTime: time.Minute}
+	chain, headers := timedChain(50, 1000, time.Minute)
+	parent := chain[len(chain)-1]
+	h := parent
+	h.Height++
+	h.Previous = parent.Hash()
+	h.Timestamp = parent.Timestamp.Add(time.Minute)
+	h.TotalDifficulty += 1000
+	now := h.Timestamp
+	if err := rules.Validate(&h, h.Hash(), headers, now); err != nil {
+		t.Fatal(err)
+	}
+	// A forged header claiming all the difficulty there can be does not take over the chain.
+	for _, td := range []uint64{math.MaxUint64, parent.TotalDifficulty + 1001, parent.TotalDifficulty + 999} {
+		forged := h
+		forged.TotalDifficulty = td
+		if err := rules.Validate(&forged, forged.Hash(), headers, now); !errors.Is(err, ErrDifficulty) {
+			t.Errorf("wrong error for total difficulty %v: expecting %v, got %v", td, ErrDifficulty, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package validation
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/zkirill/gringo/message"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Easiness is the percentage of the possible edges of the Cuckoo graph that a proof may use.
+const Easiness = 50
+
+// maxTarget is the target of a proof of difficulty one.
+const maxTarget = 0x0fffffffffffffff
+
+// ErrProofOfWork is returned when the proof of work is not a cycle in the graph of the header
+// or does not meet the difficulty of the header.
+var ErrProofOfWork = errors.New("invalid proof of work")
+
+// ProofDifficulty returns the difficulty met by the proof.
+func ProofDifficulty(p message.Proof) uint64 {
+	h := p.Hash()
+	num := binary.BigEndian.Uint64(h[:8])
+	if num == 0 {
+		return maxTarget
+	}
+	return maxTarget / num
+}
+
+// cuckoo is the Cuckoo graph of a header.
+type cuckoo struct {
+	// v is the initial state of siphash for the keys of the header.
+	v [4]uint64
+	// size is the number of nodes.
+	size uint64
+	// mask selects a node in one half of the graph.
+	mask uint64
+}
+
+// newCuckoo returns the graph of the header hash with 2^sizeShift nodes.
+func newCuckoo(hash message.Hash, sizeShift uint8) *cuckoo {
+	keys := blake2b.Sum256(hash[:])
+	k0 := binary.LittleEndian.Uint64(keys[0:8])
+	k1 := binary.LittleEndian.Uint64(keys[8:16])
+	size := uint64(1) << sizeShift
+	return &cuckoo{
+		v: [4]uint64{
+			k0 ^ 0x736f6d6570736575,
+			k1 ^ 0x646f72616e646f6d,
+			k0 ^ 0x6c7967656e657261,
+			k1 ^ 0x7465646279746573,
+		},
+		size: size,
+		mask: size/2 - 1,
+	}
+}
+
+// node returns the node of the edge with the nonce in the first half of the graph if uorv is 0,
+// or in the second half if it is 1.
+func (c *cuckoo) node(nonce, uorv uint64) uint64 {
+	return (siphash24(c.v, 2*nonce+uorv)&c.mask)<<1 | uorv
+}
+
+// verify returns the reason why the nonces are not the edges of a cycle through all of them, or nil if they are.
+func (c *cuckoo) verify(nonces []uint32) error {
+	easiness := Easiness * c.size / 100
+	n := len(nonces)
+	us := make([]uint64, n)
+	vs := make([]uint64, n)
+	for i, nonce := range nonces {
+		if uint64(nonce) >= easiness {
+			return fmt.Errorf("nonce %v too large", nonce)
+		}
+		if i > 0 && nonce <= nonces[i-1] {
+			return fmt.Errorf("nonces not ascending at %v", i)
+		}
+		us[i] = c.node(uint64(nonce), 0)
+		vs[i] = c.node(uint64(nonce), 1)
+	}
+	// Walk the cycle, alternating between the edges sharing a node in each half.
+	count := n
+	for i := 0; ; {
+		j, err := other(vs, i)
+		if err != nil {
+			return err
+		}
+		if i, err = other(us, j); err != nil {
+			return err
+		}
+		count -= 2
+		if i == 0 {
+			break
+		}
+	}
+	if count != 0 {
+		return fmt.Errorf("cycle through %v of %v edges", n-count, n)
+	}
+	return nil
+}
+
+// other returns the only other edge that shares the node of edge i.
+func other(nodes []uint64, i int) (int, error) {
+	j := i
+	for k := range nodes {
+		if k != i && nodes[k] == nodes[i] {
+			if j != i {
+				return 0, errors.New("branch in cycle")
+			}
+			j = k
+		}
+	}
+	if j == i {
+		return 0, errors.New("dead end in cycle")
+	}
+	return j, nil
+}
+
+// siphash24 returns the SipHash-2-4 of the nonce from the initial state v.
+func siphash24(v [4]uint64, nonce uint64) uint64 {
+	v0, v1, v2, v3 := v[0], v[1], v[2], v[3]^nonce
+	round := func() {
+		v0 += v1
+		v2 += v3
+		v1 = bits.RotateLeft64(v1, 13)
+		v3 = bits.RotateLeft64(v3, 16)
+		v1 ^= v0
+		v3 ^= v2
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v1
+		v0 += v3
+		v1 = bits.RotateLeft64(v1, 17)
+		v3 = bits.RotateLeft64(v3, 21)
+		v1 ^= v2
+		v3 ^= v0
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+	round()
+	round()
+	v0 ^= nonce
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
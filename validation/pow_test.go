@@ -0,0 +1,82 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+)
+
+// findCycle returns the ascending nonces of a cycle of four edges in a graph of 16 nodes, and the graph.
+// Cycles are found by checking that four different edges share four nodes, two each.
+func findCycle(t *testing.T) ([]uint32, *cuckoo) {
+	for i := 0; i < 256; i++ {
+		c := newCuckoo(message.Hash{uint8(i)}, 4)
+		n := uint32(Easiness * c.size / 100)
+		for a := uint32(0); a < n; a++ {
+			for b := a + 1; b < n; b++ {
+				for d := b + 1; d < n; d++ {
+					for e := d + 1; e < n; e++ {
+						nonces := []uint32{a, b, d, e}
+						degrees := make(map[uint64]int)
+						edges := make(map[[2]uint64]struct{})
+						for _, nonce := range nonces {
+							u, v := c.node(uint64(nonce), 0), c.node(uint64(nonce), 1)
+							degrees[u]++
+							degrees[v]++
+							edges[[2]uint64{u, v}] = struct{}{}
+						}
+						// Otherwise two pairs of the same edge would make two cycles.
+						cycle := len(degrees) == 4 && len(edges) == 4
+						for _, deg := range degrees {
+							cycle = cycle && deg == 2
+						}
+						if cycle {
+							return nonces, c
+						}
+					}
+				}
+			}
+		}
+	}
+	t.Fatal("no cycle found")
+	return nil, nil
+}
+
+func TestCuckoo(t *testing.T) {
+	nonces, c := findCycle(t)
+	if err := c.verify(nonces); err != nil {
+		t.Fatalf("cycle %v not verified: %v", nonces, err)
+	}
+	easiness := uint32(Easiness * c.size / 100)
+	tests := map[string][]uint32{
+		"not ascending": {nonces[1], nonces[0], nonces[2], nonces[3]},
+		"too large":     {nonces[0], nonces[1], nonces[2], easiness},
+		"three edges":   nonces[:3],
+	}
+	for name, bad := range tests {
+		if err := c.verify(bad); err == nil {
+			t.Errorf("%v: bad cycle %v verified", name, bad)
+		}
+	}
+}
+
+func TestValidateProofOfWork(t *testing.T) {
+	chain, headers := testChain(2)
+	parent := chain[len(chain)-1]
+	h := parent
+	h.Height++
+	h.Previous = parent.Hash()
+	h.Timestamp = parent.Timestamp.Add(time.Minute)
+	h.TotalDifficulty += 10
+	rules := Rules{SizeShift: 10}
+	// The nonces of the test headers are all zero.
+	if err := rules.Validate(&h, h.Hash(), headers, h.Timestamp); !errors.Is(err, ErrProofOfWork) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrProofOfWork, err)
+	}
+	h.ProofOfWork.Nonces = h.ProofOfWork.Nonces[:4]
+	if err := rules.Validate(&h, h.Hash(), headers, h.Timestamp); !errors.Is(err, ErrProofOfWork) {
+		t.Errorf("wrong error: expecting %v, got %v", ErrProofOfWork, err)
+	}
+}
@@ -0,0 +1,65 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/params"
+)
+
+// testnet2Headers is the file with headers of test network 2 shared with the message tests.
+const testnet2Headers = "../message/testdata/testnet2_headers.json"
+
+func TestTestnet2Headers(t *testing.T) {
+	data, err := os.ReadFile(testnet2Headers)
+	if os.IsNotExist(err) {
+		t.Skipf("no headers of test network 2 in %v", testnet2Headers)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []struct {
+		Height uint64
+		Hash   message.Hash
+		Header string
+	}
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	chain := make([]message.BlockHeader, len(vectors))
+	headers := make(testHeaders)
+	for i, v := range vectors {
+		b, err := hex.DecodeString(v.Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := chain[i].Read(bytes.NewReader(b)); err != nil {
+			t.Fatalf("could not read header at height %v: %v", v.Height, err)
+		}
+		headers[v.Hash] = chain[i]
+	}
+	rules := RulesFor(params.Testnet2)
+	checked := 0
+	for i := 1; i < len(chain); i++ {
+		h, parent := &chain[i], &chain[i-1]
+		// The difficulty and the median time need the headers of the whole window.
+		if chain[0].Height != 0 && i < DifficultyAdjustWindow+MedianTimeSpan {
+			continue
+		}
+		want := h.TotalDifficulty - parent.TotalDifficulty
+		if got, err := rules.NextDifficulty(parent, headers); err != nil || got != want {
+			t.Errorf("wrong difficulty at height %v: expecting %v, got %v, %v", h.Height, want, got, err)
+		}
+		if err := rules.Validate(h, vectors[i].Hash, headers, h.Timestamp); err != nil {
+			t.Error(err)
+		}
+		checked++
+	}
+	if checked == 0 {
+		t.Errorf("too few headers in %v to check the difficulty", testnet2Headers)
+	}
+}
@@ -0,0 +1,183 @@
+// Package validation checks blocks and their headers against the consensus rules.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/params"
+)
+
+// MedianTimeSpan is the number of previous headers whose median timestamp a header must follow.
+const MedianTimeSpan = 11
+
+// FutureBlocks is how many block times ahead of our clock a timestamp may be.
+const FutureBlocks = 12
+
+var (
+	// ErrUnknownParent is returned when the parent of the header is unknown.
+	ErrUnknownParent = errors.New("unknown parent")
+	// ErrHeight is returned when the height of the header does not follow the height of its parent.
+	ErrHeight = errors.New("wrong height")
+	// ErrTimestampTooEarly is returned when the timestamp is not after the median timestamp of the previous headers.
+	ErrTimestampTooEarly = errors.New("timestamp too early")
+	// ErrTimestampTooLate is returned when the timestamp is too far in the future.
+	ErrTimestampTooLate = errors.New("timestamp too far in the future")
+	// ErrVersion is returned when the version is not the one expected at the height.
+	ErrVersion = errors.New("wrong version")
+	// ErrDifficulty is returned when the total difficulty does not grow by the difficulty expected of the header.
+	ErrDifficulty = errors.New("wrong total difficulty")
+)
+
+// Error is returned when a block or its header breaks a rule.
+type Error struct {
+	// Hash is the hash of the block.
+	Hash message.Hash
+	// Height is the height of the block.
+	Height uint64
+	// Err is the rule that was broken.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid block %v at height %v: %v", e.Hash, e.Height, e.Err)
+}
+
+// Unwrap returns the rule that was broken.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Headers looks up the headers that a header is validated against.
+type Headers interface {
+	// Header returns the header with the hash, or an error if it is unknown.
+	Header(hash message.Hash) (message.BlockHeader, error)
+}
+
+// Rules are the consensus rules of a network.
+type Rules struct {
+	// FutureTimeLimit is how far ahead of our clock a timestamp may be. There is no limit if zero.
+	FutureTimeLimit time.Duration
+	// HardForks are the heights at which the header version goes up by one, starting from version 1.
+	HardForks []uint64
+	// MinDifficulty is the least difficulty of a block. Total difficulty must always grow, so one is used if zero.
+	MinDifficulty uint64
+	// InitialDifficulty is the difficulty of the blocks assumed before the genesis.
+	// The difficulty of the genesis is used if zero.
+	InitialDifficulty uint64
+	// BlockTime is the target time between blocks. The difficulty of each block must be the one given by
+	// NextDifficulty if set, or else at least MinDifficulty.
+	BlockTime time.Duration
+	// SizeShift is the binary logarithm of the number of nodes of the Cuckoo graph.
+	// The proof of work is not verified if zero.
+	SizeShift uint8
+}
+
+// RulesFor returns the rules of the network.
+func RulesFor(n *params.Network) Rules {
+	return Rules{
+		FutureTimeLimit:   FutureBlocks * n.BlockTime,
+		HardForks:         n.HardForks,
+		MinDifficulty:     n.MinDifficulty,
+		InitialDifficulty: n.InitialDifficulty,
+		BlockTime:         n.BlockTime,
+		SizeShift:         n.SizeShift,
+	}
+}
+
+// minDifficulty returns the least difficulty of a block.
+func (r Rules) minDifficulty() uint64 {
+	if r.MinDifficulty == 0 {
+		return 1
+	}
+	return r.MinDifficulty
+}
+
+// Version returns the header version expected at the height.
+func (r Rules) Version(height uint64) uint16 {
+	v := uint16(1)
+	for _, fork := range r.HardForks {
+		if height >= fork {
+			v++
+		}
+	}
+	return v
+}
+
+// Validate checks the header with the hash against its parent and the headers before it, which are looked up in headers.
+// now is the time of our clock. The error is an *Error if the header breaks a rule.
+func (r Rules) Validate(h *message.BlockHeader, hash message.Hash, headers Headers, now time.Time) error {
+	if err := r.validate(h, headers, now); err != nil {
+		return &Error{Hash: hash, Height: h.Height, Err: err}
+	}
+	return nil
+}
+
+// validate returns the rule that the header breaks.
+func (r Rules) validate(h *message.BlockHeader, headers Headers, now time.Time) error {
+	parent, err := headers.Header(h.Previous)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnknownParent, h.Previous)
+	}
+	if h.Height != parent.Height+1 {
+		return fmt.Errorf("%w: %v after %v", ErrHeight, h.Height, parent.Height)
+	}
+	if v := r.Version(h.Height); h.Version != v {
+		return fmt.Errorf("%w: %v, expecting %v", ErrVersion, h.Version, v)
+	}
+	median, err := medianTime(&parent, headers)
+	if err != nil {
+		return err
+	}
+	if !h.Timestamp.After(median) {
+		return fmt.Errorf("%w: %v not after median %v", ErrTimestampTooEarly, h.Timestamp, median)
+	}
+	if limit := now.Add(r.FutureTimeLimit); r.FutureTimeLimit > 0 && h.Timestamp.After(limit) {
+		return fmt.Errorf("%w: %v after %v", ErrTimestampTooLate, h.Timestamp, limit)
+	}
+	if h.TotalDifficulty < parent.TotalDifficulty {
+		return fmt.Errorf("%w: %v after %v", ErrDifficulty, h.TotalDifficulty, parent.TotalDifficulty)
+	}
+	difficulty := h.TotalDifficulty - parent.TotalDifficulty
+	if r.BlockTime > 0 {
+		next, err := r.NextDifficulty(&parent, headers)
+		if err != nil {
+			return err
+		}
+		if difficulty != next {
+			return fmt.Errorf("%w: %v after %v, expecting %v more", ErrDifficulty, h.TotalDifficulty, parent.TotalDifficulty, next)
+		}
+	} else if min := r.minDifficulty(); difficulty < min {
+		return fmt.Errorf("%w: %v after %v, expecting at least %v more", ErrDifficulty, h.TotalDifficulty, parent.TotalDifficulty, min)
+	}
+	if r.SizeShift > 0 {
+		if n := len(h.ProofOfWork.Nonces); n != message.ProofSize {
+			return fmt.Errorf("%w: %v nonces, expecting %v", ErrProofOfWork, n, message.ProofSize)
+		}
+		if err := newCuckoo(h.PrePoWHash(), r.SizeShift).verify(h.ProofOfWork.Nonces); err != nil {
+			return fmt.Errorf("%w: %v", ErrProofOfWork, err)
+		}
+		if d := ProofDifficulty(h.ProofOfWork); d < difficulty {
+			return fmt.Errorf("%w: difficulty %v below %v", ErrProofOfWork, d, difficulty)
+		}
+	}
+	return nil
+}
+
+// medianTime returns the median timestamp of the header and the headers before it, up to MedianTimeSpan headers.
+func medianTime(h *message.BlockHeader, headers Headers) (time.Time, error) {
+	times := []time.Time{h.Timestamp}
+	for prev := *h; len(times) < MedianTimeSpan && prev.Height > 0; {
+		next, err := headers.Header(prev.Previous)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: ancestor %v at height %v", ErrUnknownParent, prev.Previous, prev.Height-1)
+		}
+		prev = next
+		times = append(times, prev.Timestamp)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times[len(times)/2], nil
+}
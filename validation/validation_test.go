@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zkirill/gringo/message"
+	"github.com/zkirill/gringo/params"
+)
+
+// testHeaders is a set of headers by hash.
+type testHeaders map[message.Hash]message.BlockHeader
+
+func (t testHeaders) Header(hash message.Hash) (message.BlockHeader, error) {
+	h, ok := t[hash]
+	if !ok {
+		return message.BlockHeader{}, fmt.Errorf("unknown header %v", hash)
+	}
+	return h, nil
+}
+
+// testChain returns a chain of n headers, one minute apart, and its headers by hash.
+func testChain(n int) ([]message.BlockHeader, testHeaders) {
+	chain := make([]message.BlockHeader, n)
+	headers := make(testHeaders)
+	for i := range chain {
+		h := message.BlockHeader{
+			Version:         1,
+			Height:          uint64(i),
+			Timestamp:       time.Date(2018, 1, 1, 0, i, 0, 0, time.UTC),
+			TotalDifficulty: uint64(i+1) * 10,
+			ProofOfWork:     message.Proof{Nonces: make([]uint32, message.ProofSize)},
+		}
+		if i > 0 {
+			h.Previous = chain[i-1].Hash()
+		}
+		chain[i] = h
+		headers[h.Hash()] = h
+	}
+	return chain, headers
+}
+
+func TestValidate(t *testing.T) {
+	chain, headers := testChain(20)
+	parent := chain[len(chain)-1]
+	now := parent.Timestamp.Add(time.Minute)
+	rules := Rules{FutureTimeLimit: time.Hour, MinDifficulty: 5}
+	// next returns a valid child of the parent changed by f.
+	next := func(f func(h *message.BlockHeader)) *message.BlockHeader {
+		h := parent
+		h.Height++
+		h.Previous = parent.Hash()
+		h.Timestamp = now
+		h.TotalDifficulty += 10
+		f(&h)
+		return &h
+	}
+	tests := []struct {
+		name string
+		h    *message.BlockHeader
+		want error
+	}{
+		{"valid", next(func(*message.BlockHeader) {}), nil},
+		{"unknown parent", next(func(h *message.BlockHeader) { h.Previous = message.Hash{1} }), ErrUnknownParent},
+		{"height", next(func(h *message.BlockHeader) { h.Height += 2 }), ErrHeight},
+		{"version", next(func(h *message.BlockHeader) { h.Version = 2 }), ErrVersion},
+		// The median of the last 11 headers is 5 minutes before the parent.
+		{"after median", next(func(h *message.BlockHeader) { h.Timestamp = parent.Timestamp.Add(-4 * time.Minute) }), nil},
+		{"at median", next(func(h *message.BlockHeader) { h.Timestamp = parent.Timestamp.Add(-5 * time.Minute) }), ErrTimestampTooEarly},
+		{"future", next(func(h *message.BlockHeader) { h.Timestamp = now.Add(2 * time.Hour) }), ErrTimestampTooLate},
+		{"difficulty", next(func(h *message.BlockHeader) { h.TotalDifficulty = parent.TotalDifficulty + 4 }), ErrDifficulty},
+		{"difficulty decreasing", next(func(h *message.BlockHeader) { h.TotalDifficulty = 0 }), ErrDifficulty},
+	}
+	for _, tt := range tests {
+		err := rules.Validate(tt.h, tt.h.Hash(), headers, now)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%v: wrong error: expecting %v, got %v", tt.name, tt.want, err)
+		}
+		var verr *Error
+		if err != nil && (!errors.As(err, &verr) || verr.Height != tt.h.Height || verr.Hash != tt.h.Hash()) {
+			t.Errorf("%v: wrong error type: %#v", tt.name, err)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	r := Rules{HardForks: []uint64{262080, 524160, 786240, 1048320}}
+	for height, want := range map[uint64]uint16{0: 1, 262079: 1, 262080: 2, 524160: 3, 786240: 4, 1048320: 5, 2000000: 5} {
+		if got := r.Version(height); got != want {
+			t.Errorf("wrong version at height %v: expecting %v, got %v", height, want, got)
+		}
+	}
+	if got := RulesFor(params.Testnet2).Version(1000000); got != 1 {
+		t.Errorf("wrong version on test network 2: %v", got)
+	}
+}